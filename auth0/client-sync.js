@@ -0,0 +1,66 @@
+let cli = require("cli");
+let secret = require("secret");
+
+let request = require("auth0/common").request;
+
+let clientData = function (def) {
+    let data = {
+        "name": def["name"],
+        "app_type": def["app-type"],
+        "callbacks": def["callbacks"] || [],
+        "allowed_logout_urls": def["allowed-logout-urls"] || [],
+        "web_origins": def["web-origins"] || []
+    };
+    if (def["grant-types"]) {
+        data["grant_types"] = def["grant-types"];
+    }
+    return data;
+};
+
+let createClient = function (def) {
+    let client = request(def, "post", "/clients", clientData(def));
+    if (def["client-secret-secret"] && client.client_secret) {
+        secret.set(def["client-secret-secret"], client.client_secret);
+    }
+    return {"client-id": client.client_id, "name": client.name};
+};
+
+let updateClient = function (def, state) {
+    let client = request(def, "patch", "/clients/" + state["client-id"], clientData(def));
+    return {"client-id": client.client_id, "name": client.name};
+};
+
+let deleteClient = function (def, state) {
+    if (!state["client-id"]) {
+        return;
+    }
+    try {
+        request(def, "delete", "/clients/" + state["client-id"]);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+    if (def["client-secret-secret"]) {
+        try {
+            secret.remove(def["client-secret-secret"]);
+        } catch (error) {
+            cli.output("Secret not found");
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createClient(def);
+        case "update":
+            return updateClient(def, state);
+        case "purge":
+            deleteClient(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
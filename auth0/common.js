@@ -0,0 +1,64 @@
+// Management API access shared by the Auth0 entities: minting and caching
+// the token, and sending requests with it.
+let http = require("http");
+let secret = require("secret");
+let tokenCache = require("common/token-cache");
+
+// tokens caches Management API tokens by tenant domain and client ID
+let tokens = tokenCache.tokenCache({
+    "key": function (def) {
+        return def["domain"] + "/" + def["management-client-id"];
+    },
+    // getAuthToken mints a token with the client credentials grant
+    "getAuthToken": function (def) {
+        let res = http.post("https://" + def["domain"] + "/oauth/token", {
+            "headers": {"Content-Type": "application/json"},
+            "body": JSON.stringify({
+                "grant_type": "client_credentials",
+                "client_id": def["management-client-id"],
+                "client_secret": secret.get(def["management-client-secret"]),
+                "audience": "https://" + def["domain"] + "/api/v2/"
+            })
+        });
+        if (res.error) {
+            throw new Error("get management token: " + res.error + ", " + res.body);
+        }
+        let body = JSON.parse(res.body);
+        return {"token": body.access_token, "expires-in": body.expires_in};
+    }
+});
+
+// managementToken returns a Management API token, minting one only when
+// there is no cached token for the same tenant and client that is valid for
+// at least another minute. With token-cache-secret set the token is shared
+// across runs and entities.
+let managementToken = function (def) {
+    return tokens.token(def);
+};
+
+let request = function (def, method, path, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "Authorization": "Bearer " + managementToken(def),
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do("https://" + def["domain"] + "/api/v2" + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).message;
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+exports.managementToken = managementToken;
+exports.request = request;
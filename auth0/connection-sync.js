@@ -0,0 +1,62 @@
+
+let request = require("auth0/common").request;
+
+let enabledClients = function (def) {
+    let clients = (def["enabled-clients"] || []).slice();
+    if (def["client-id"] && !clients.includes(def["client-id"])) {
+        clients.push(def["client-id"]);
+    }
+    return clients;
+};
+
+let createConnection = function (def) {
+    let connection = request(def, "post", "/connections", {
+        "name": def["name"],
+        "strategy": def["strategy"],
+        "options": def["options"] || {},
+        "enabled_clients": enabledClients(def)
+    });
+    return {"id": connection.id, "name": connection.name};
+};
+
+// updateConnection can't change the name or the strategy, Auth0 only allows
+// patching the options and the enabled applications
+let updateConnection = function (def, state) {
+    let connection = request(def, "get", "/connections/" + state["id"]);
+    if (connection.strategy !== def["strategy"] || connection.name !== def["name"]) {
+        throw new Error("the name and strategy of connection " + connection.name + " can't be changed, recreate it instead");
+    }
+    request(def, "patch", "/connections/" + state["id"], {
+        "options": def["options"] || {},
+        "enabled_clients": enabledClients(def)
+    });
+    return state;
+};
+
+let deleteConnection = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    try {
+        request(def, "delete", "/connections/" + state["id"]);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createConnection(def);
+        case "update":
+            return updateConnection(def, state);
+        case "purge":
+            deleteConnection(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
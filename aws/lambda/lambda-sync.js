@@ -0,0 +1,168 @@
+let aws = require("cloud/aws");
+let cli = require("cli");
+
+let lambda = function (def, method, path, body) {
+    let opts = {
+        "service": "lambda",
+        "region": def["region"],
+        "headers": {"Content-Type": "application/json"}
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = aws[method]("https://lambda." + def["region"] + ".amazonaws.com/2015-03-31/functions" + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            let body = JSON.parse(res.body);
+            message = (body.Type || body.__type) + ": " + (body.Message || body.message);
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+let functionPath = function (def) {
+    return "/" + encodeURIComponent(def["name"]);
+};
+
+let code = function (def) {
+    let data = {"S3Bucket": def["s3-bucket"], "S3Key": def["s3-key"]};
+    if (def["s3-object-version"]) {
+        data["S3ObjectVersion"] = def["s3-object-version"];
+    }
+    return data;
+};
+
+// codeId identifies the deployed package, a new key or object version
+// means new code
+let codeId = function (def) {
+    return "s3://" + def["s3-bucket"] + "/" + def["s3-key"] + (def["s3-object-version"] ? "?versionId=" + def["s3-object-version"] : "");
+};
+
+let configuration = function (def) {
+    return {
+        "Role": def["role-arn"],
+        "Runtime": def["runtime"],
+        "Handler": def["handler"],
+        "MemorySize": def["memory"] || 128,
+        "Timeout": def["timeout"] || 3,
+        "Description": def["description"] || "",
+        "Environment": {"Variables": def["environment"] || {}}
+    };
+};
+
+let sortedObject = function (obj) {
+    let sorted = {};
+    Object.keys(obj || {}).sort().forEach(function (key) {
+        sorted[key] = obj[key];
+    });
+    return sorted;
+};
+
+let configChanged = function (current, desired) {
+    return Object.keys(desired).some(function (key) {
+        if (key === "Environment") {
+            let vars = current.Environment ? current.Environment.Variables : {};
+            return JSON.stringify(sortedObject(vars)) !== JSON.stringify(sortedObject(desired.Environment.Variables));
+        }
+        return JSON.stringify(current[key]) !== JSON.stringify(desired[key]);
+    });
+};
+
+let toState = function (def, fn, pending) {
+    return {
+        "arn": fn.FunctionArn.replace(/:\d+$/, ""),
+        "version": fn.Version,
+        "version-arn": fn.FunctionArn,
+        "code": codeId(def),
+        "pending": pending || []
+    };
+};
+
+let createFunction = function (def) {
+    let data = Object.assign({"FunctionName": def["name"], "Code": code(def), "Publish": true}, configuration(def));
+    return toState(def, lambda(def, "post", "", data));
+};
+
+// updateFunction applies configuration and code changes and publishes a new
+// version. Lambda rejects a second update while one is in progress, so when
+// both changed, or the configuration changed and a version must be
+// published, the remaining step is left to the readiness check.
+let updateFunction = function (def, state) {
+    let current = lambda(def, "get", functionPath(def)).Configuration;
+    let desired = configuration(def);
+    let codeUpdated = codeId(def) !== state["code"];
+
+    if (configChanged(current, desired)) {
+        let updated = lambda(def, "put", functionPath(def) + "/configuration", desired);
+        cli.output("Updated configuration of " + def["name"]);
+        return Object.assign({}, state, {
+            "code": codeId(def),
+            "pending": [codeUpdated ? "code" : "publish"],
+            "revision": updated.RevisionId
+        });
+    }
+    if (codeUpdated) {
+        let fn = lambda(def, "put", functionPath(def) + "/code", Object.assign({"Publish": true}, code(def)));
+        cli.output("Deployed " + codeId(def) + " as version " + fn.Version + " of " + def["name"]);
+        return toState(def, fn);
+    }
+    return state;
+};
+
+// checkReadiness waits for the function to become active and for any update
+// to finish, then runs the step updateFunction left pending. Starting the
+// code update fails the check, so it keeps polling until that update has
+// finished too; the function's revision tells whether it was started.
+let checkReadiness = function (def, state) {
+    let current = lambda(def, "get", functionPath(def)).Configuration;
+    if (current.State === "Failed" || current.LastUpdateStatus === "Failed") {
+        throw new Error("function " + def["name"] + " failed: " + (current.StateReason || current.LastUpdateStatusReason));
+    }
+    if (current.State !== "Active" || (current.LastUpdateStatus && current.LastUpdateStatus !== "Successful")) {
+        throw new Error("function " + def["name"] + " is " + current.State + ", last update " + current.LastUpdateStatus);
+    }
+
+    let pending = state["pending"] || [];
+    if (pending.includes("code") && current.RevisionId === state["revision"]) {
+        lambda(def, "put", functionPath(def) + "/code", code(def));
+        cli.output("Deploying " + codeId(def) + " to " + def["name"]);
+        throw new Error("code update of " + def["name"] + " started");
+    }
+    if (pending.length > 0) {
+        let fn = lambda(def, "post", functionPath(def) + "/versions", {"RevisionId": current.RevisionId});
+        cli.output("Published version " + fn.Version + " of " + def["name"]);
+        return toState(def, fn);
+    }
+    return state;
+};
+
+let deleteFunction = function (def) {
+    try {
+        lambda(def, "delete", functionPath(def));
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createFunction(def);
+        case "update":
+            return updateFunction(def, state);
+        case "check-readiness":
+            return checkReadiness(def, state);
+        case "purge":
+            deleteFunction(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,151 @@
+let cli = require("cli");
+let parser = require("parser");
+
+const S3_NS = "http://s3.amazonaws.com/doc/2006-03-01/";
+
+let bucketUrl = function (def) {
+    // us-east-1 has no regional endpoint suffix
+    if (!def.region || def.region === "us-east-1") {
+        return "https://" + def.name + ".s3.amazonaws.com";
+    }
+    return "https://" + def.name + ".s3." + def.region + ".amazonaws.com";
+};
+
+let s3 = function (method, def, query, body) {
+    let url = bucketUrl(def) + "/" + (query || "");
+    let opts = {"service": "s3", "region": def.region || "us-east-1"};
+    if (body) {
+        opts["headers"] = {"Content-Type": "application/xml"};
+        opts["body"] = body;
+    }
+    return aws[method](url, opts);
+};
+
+let checkError = function (res, action) {
+    if (res.error) {
+        let message = parser.xmlquery(res.body, "//Error/Message");
+        throw new Error(action + ": " + res.error + ", " + (message.length ? message[0] : res.body));
+    }
+};
+
+let createBucket = function (def) {
+    let body = "";
+    // creating a bucket in us-east-1 fails if LocationConstraint is set
+    if (def.region && def.region !== "us-east-1") {
+        body = `<CreateBucketConfiguration xmlns="${S3_NS}"><LocationConstraint>${def.region}</LocationConstraint></CreateBucketConfiguration>`;
+    }
+    let res = s3("put", def, "", body);
+    if (res.error && res.body && res.body.includes("BucketAlreadyOwnedByYou")) {
+        cli.output("Bucket " + def.name + " already exists, reconciling its settings");
+        return;
+    }
+    checkError(res, "create bucket");
+};
+
+let setVersioning = function (def) {
+    if (def.versioning === undefined) {
+        return;
+    }
+    let status = def.versioning ? "Enabled" : "Suspended";
+    let res = s3("put", def, "?versioning",
+        `<VersioningConfiguration xmlns="${S3_NS}"><Status>${status}</Status></VersioningConfiguration>`);
+    checkError(res, "set versioning");
+};
+
+let setPublicAccessBlock = function (def) {
+    let res = s3("put", def, "?publicAccessBlock",
+        `<PublicAccessBlockConfiguration xmlns="${S3_NS}">` +
+        `<BlockPublicAcls>${def["block-public-acls"] !== false}</BlockPublicAcls>` +
+        `<IgnorePublicAcls>${def["ignore-public-acls"] !== false}</IgnorePublicAcls>` +
+        `<BlockPublicPolicy>${def["block-public-policy"] !== false}</BlockPublicPolicy>` +
+        `<RestrictPublicBuckets>${def["restrict-public-buckets"] !== false}</RestrictPublicBuckets>` +
+        `</PublicAccessBlockConfiguration>`);
+    checkError(res, "set public access block");
+};
+
+let setEncryption = function (def) {
+    if (!def.encryption) {
+        return;
+    }
+    let rule = `<SSEAlgorithm>${def.encryption}</SSEAlgorithm>`;
+    if (def["kms-key-id"]) {
+        rule += `<KMSMasterKeyID>${def["kms-key-id"]}</KMSMasterKeyID>`;
+    }
+    let res = s3("put", def, "?encryption",
+        `<ServerSideEncryptionConfiguration xmlns="${S3_NS}"><Rule>` +
+        `<ApplyServerSideEncryptionByDefault>${rule}</ApplyServerSideEncryptionByDefault>` +
+        `<BucketKeyEnabled>${!!def["bucket-key-enabled"]}</BucketKeyEnabled>` +
+        `</Rule></ServerSideEncryptionConfiguration>`);
+    checkError(res, "set encryption");
+};
+
+let configureBucket = function (def) {
+    setVersioning(def);
+    setPublicAccessBlock(def);
+    setEncryption(def);
+};
+
+// emptyBucket removes every object version and delete marker, so it works for
+// versioned buckets too
+let emptyBucket = function (def) {
+    for (;;) {
+        let res = s3("get", def, "?versions");
+        checkError(res, "list objects");
+
+        let objects = [];
+        ["Version", "DeleteMarker"].forEach(function (kind) {
+            let keys = parser.xmlquery(res.body, "//" + kind + "/Key");
+            let versions = parser.xmlquery(res.body, "//" + kind + "/VersionId");
+            for (let i = 0; i < keys.length; i++) {
+                objects.push({key: keys[i], version: versions[i]});
+            }
+        });
+        if (objects.length === 0) {
+            return;
+        }
+
+        cli.output("Deleting " + objects.length + " objects from " + def.name);
+        objects.forEach(function (obj) {
+            let query = encodeURIComponent(obj.key).replace(/%2F/g, "/");
+            if (obj.version && obj.version !== "null") {
+                query += "?versionId=" + encodeURIComponent(obj.version);
+            }
+            let res = s3("delete", def, query);
+            checkError(res, "delete object " + obj.key);
+        });
+    }
+};
+
+let deleteBucket = function (def) {
+    if (def["empty-on-delete"]) {
+        emptyBucket(def);
+    }
+    let res = s3("delete", def, "");
+    if (res.error && res.error.includes("response code 404")) {
+        // bucket is already removed
+        return;
+    }
+    if (res.error && res.body && res.body.includes("BucketNotEmpty")) {
+        throw new Error("bucket " + def.name + " is not empty, set empty-on-delete to remove its objects");
+    }
+    checkError(res, "delete bucket");
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            createBucket(def);
+            configureBucket(def);
+            break;
+        case "update":
+            configureBucket(def);
+            break;
+        case "purge":
+            deleteBucket(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+    return {"name": def.name, "region": def.region, "url": bucketUrl(def)};
+}
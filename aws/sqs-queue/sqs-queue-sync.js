@@ -0,0 +1,147 @@
+let aws = require("cloud/aws");
+let cli = require("cli");
+
+// FIFO_ATTRIBUTES can only be set on FIFO queues
+const FIFO_ATTRIBUTES = ["ContentBasedDeduplication", "DeduplicationScope", "FifoThroughputLimit"];
+
+let sqs = function (def, action, body) {
+    let res = aws.post("https://sqs." + def["region"] + ".amazonaws.com/", {
+        "service": "sqs",
+        "region": def["region"],
+        "headers": {
+            "X-Amz-Target": "AmazonSQS." + action,
+            "Content-Type": "application/x-amz-json-1.0"
+        },
+        "body": JSON.stringify(body)
+    });
+    if (res.error) {
+        let message = res.body;
+        try {
+            let body = JSON.parse(res.body);
+            message = body.__type + ": " + body.message;
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(action + ": " + res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+// attributes maps the definition to SQS queue attributes, which SQS takes
+// as strings. Attributes left out of the definition keep their SQS defaults.
+let attributes = function (def) {
+    let attrs = {};
+    let set = function (name, value) {
+        if (value !== undefined && value !== null && value !== "") {
+            attrs[name] = String(value);
+        }
+    };
+    set("VisibilityTimeout", def["visibility-timeout"]);
+    set("MessageRetentionPeriod", def["message-retention"]);
+    set("DelaySeconds", def["delay"]);
+    set("MaximumMessageSize", def["max-message-size"]);
+    set("ReceiveMessageWaitTimeSeconds", def["receive-wait-time"]);
+    set("ContentBasedDeduplication", def["content-based-deduplication"]);
+    set("DeduplicationScope", def["deduplication-scope"]);
+    set("FifoThroughputLimit", def["fifo-throughput-limit"]);
+    if (def["dead-letter-queue-arn"]) {
+        attrs["RedrivePolicy"] = JSON.stringify({
+            "deadLetterTargetArn": def["dead-letter-queue-arn"],
+            "maxReceiveCount": def["max-receive-count"] || 5
+        });
+    }
+
+    if (def["fifo"]) {
+        if (!def["name"].endsWith(".fifo")) {
+            throw new Error("FIFO queue name " + def["name"] + " must end with .fifo");
+        }
+    } else {
+        let fifoOnly = Object.keys(attrs).filter(function (name) {
+            return FIFO_ATTRIBUTES.includes(name);
+        });
+        if (fifoOnly.length > 0) {
+            throw new Error(fifoOnly.join(", ") + " can only be set on FIFO queues, set fifo: true");
+        }
+    }
+    return attrs;
+};
+
+let queueState = function (def, url) {
+    let current = sqs(def, "GetQueueAttributes", {"QueueUrl": url, "AttributeNames": ["QueueArn"]});
+    return {"url": url, "arn": current.Attributes.QueueArn, "fifo": !!def["fifo"]};
+};
+
+let createQueue = function (def) {
+    let attrs = attributes(def);
+    try {
+        let existing = sqs(def, "GetQueueUrl", {"QueueName": def["name"]});
+        cli.output("Queue " + def["name"] + " already exists, reconciling its attributes");
+        return updateQueue(def, {"url": existing.QueueUrl});
+    } catch (e) {
+        if (!e.message.includes("QueueDoesNotExist") && !e.message.includes("NonExistentQueue")) {
+            throw e;
+        }
+    }
+    if (def["fifo"]) {
+        attrs["FifoQueue"] = "true";
+    }
+    let res = sqs(def, "CreateQueue", {"QueueName": def["name"], "Attributes": attrs});
+    return queueState(def, res.QueueUrl);
+};
+
+// updateQueue sends only the attributes whose value differs from the
+// queue's current one
+let updateQueue = function (def, state) {
+    let desired = attributes(def);
+    let current = sqs(def, "GetQueueAttributes", {"QueueUrl": state["url"], "AttributeNames": ["All"]}).Attributes;
+    if ((current.FifoQueue === "true") !== !!def["fifo"]) {
+        throw new Error("queue " + def["name"] + " can't be switched between standard and FIFO, recreate it instead");
+    }
+    let changed = {};
+    for (let name in desired) {
+        let same = current[name] === desired[name];
+        if (name === "RedrivePolicy" && current[name]) {
+            let a = JSON.parse(current[name]), b = JSON.parse(desired[name]);
+            same = a.deadLetterTargetArn === b.deadLetterTargetArn && Number(a.maxReceiveCount) === Number(b.maxReceiveCount);
+        }
+        if (!same) {
+            changed[name] = desired[name];
+        }
+    }
+    if (current.RedrivePolicy && !desired.RedrivePolicy) {
+        changed["RedrivePolicy"] = "";
+    }
+    if (Object.keys(changed).length > 0) {
+        sqs(def, "SetQueueAttributes", {"QueueUrl": state["url"], "Attributes": changed});
+        cli.output("Updated " + Object.keys(changed).join(", ") + " of queue " + def["name"]);
+    }
+    return {"url": state["url"], "arn": current.QueueArn, "fifo": !!def["fifo"]};
+};
+
+let deleteQueue = function (def, state) {
+    if (!state["url"]) {
+        return;
+    }
+    try {
+        sqs(def, "DeleteQueue", {"QueueUrl": state["url"]});
+    } catch (e) {
+        if (!e.message.includes("QueueDoesNotExist") && !e.message.includes("NonExistentQueue")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createQueue(def);
+        case "update":
+            return updateQueue(def, state);
+        case "purge":
+            deleteQueue(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
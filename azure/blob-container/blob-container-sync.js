@@ -0,0 +1,140 @@
+let cli = require("cli");
+let storage = require("common/azure-storage");
+
+let blob = storage.client({"name": "Azure Blob Storage", "service": "blob"});
+
+// PUBLIC_ACCESS maps the publicAccess levels to x-ms-blob-public-access,
+// which is left out for a private container
+const PUBLIC_ACCESS = {"None": "", "Blob": "blob", "Container": "container"};
+
+let containerPath = function (def, comp) {
+    return "/" + def.containerName + "?restype=container" + (comp ? "&comp=" + comp : "");
+};
+
+// containerProperties reads the properties of containerObject, with the
+// publicAccess and metadata fields taking precedence over it
+let containerProperties = function (def) {
+    let body = def.containerObject ? JSON.parse(def.containerObject) : {};
+    let properties = body.properties || {};
+    let publicAccess = def.publicAccess || properties.publicAccess || "None";
+    if (!(publicAccess in PUBLIC_ACCESS)) {
+        throw new Error("publicAccess must be one of None, Blob or Container");
+    }
+    return {
+        "publicAccess": publicAccess,
+        "metadata": def.metadata || properties.metadata || {},
+        "defaultEncryptionScope": properties.defaultEncryptionScope,
+        "denyEncryptionScopeOverride": properties.denyEncryptionScopeOverride
+    };
+};
+
+let accessHeaders = function (props) {
+    let access = PUBLIC_ACCESS[props.publicAccess];
+    return access ? {"x-ms-blob-public-access": access} : {};
+};
+
+let metadataHeaders = function (metadata) {
+    let headers = {};
+    for (let name in metadata) {
+        headers["x-ms-meta-" + name] = metadata[name];
+    }
+    return headers;
+};
+
+// getContainer returns the public access level and metadata of the
+// container, which the service answers with in headers
+let getContainer = function (def) {
+    let res = blob.send(def, "get", containerPath(def), undefined, {"cache": false});
+    let container = {"publicAccess": "None", "metadata": {}};
+    for (let name in res.headers) {
+        let value = [].concat(res.headers[name]).join(", ");
+        let key = name.toLowerCase();
+        if (key === "x-ms-blob-public-access") {
+            container.publicAccess = value === "blob" ? "Blob" : "Container";
+        } else if (key.indexOf("x-ms-meta-") === 0) {
+            container.metadata[key.substring("x-ms-meta-".length)] = value;
+        }
+    }
+    return container;
+};
+
+// sameMetadata compares metadata by name regardless of case, as the service
+// does
+let sameMetadata = function (a, b) {
+    let lower = function (metadata) {
+        let out = {};
+        for (let name in metadata) {
+            out[name.toLowerCase()] = String(metadata[name]);
+        }
+        return out;
+    };
+    a = lower(a);
+    b = lower(b);
+    return Object.keys(a).length === Object.keys(b).length && Object.keys(a).every(function (name) {
+        return b[name] === a[name];
+    });
+};
+
+let containerState = function (def, props) {
+    return {
+        "name": def.containerName,
+        "publicAccess": props.publicAccess,
+        "url": "https://" + def.accountName + ".blob.core.windows.net/" + def.containerName
+    };
+};
+
+// updateContainer applies the public access level and replaces the metadata
+// where the container differs from the definition. Setting the access level
+// also drops the container's stored access policies, so it is only set when
+// it changed.
+let updateContainer = function (def) {
+    let props = containerProperties(def);
+    let current = getContainer(def);
+    if (current.publicAccess !== props.publicAccess) {
+        blob.send(def, "put", containerPath(def, "acl"), undefined, {"headers": accessHeaders(props)});
+        cli.output("Container " + def.containerName + " has public access " + props.publicAccess);
+    }
+    if (!sameMetadata(current.metadata, props.metadata)) {
+        blob.send(def, "put", containerPath(def, "metadata"), undefined, {"headers": metadataHeaders(props.metadata)});
+        cli.output("Updated the metadata of container " + def.containerName);
+    }
+    return containerState(def, props);
+};
+
+let createContainer = function (def) {
+    let props = containerProperties(def);
+    let headers = Object.assign(accessHeaders(props), metadataHeaders(props.metadata));
+    if (props.defaultEncryptionScope) {
+        headers["x-ms-default-encryption-scope"] = props.defaultEncryptionScope;
+        headers["x-ms-deny-encryption-scope-override"] = String(props.denyEncryptionScopeOverride === true);
+    }
+    try {
+        blob.send(def, "put", containerPath(def), undefined, {"headers": headers});
+    } catch (e) {
+        if (e.code !== "ContainerAlreadyExists") {
+            throw e;
+        }
+        cli.output("Container " + def.containerName + " already exists");
+        return updateContainer(def);
+    }
+    cli.output("Container " + def.containerName + " has public access " + props.publicAccess);
+    return containerState(def, props);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createContainer(def);
+        case "update":
+            return updateContainer(def);
+        case "purge":
+            blob.remove(def, containerPath(def));
+            return;
+        case "get":
+            cli.output(JSON.stringify(getContainer(def), null, 2));
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,202 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+let BASE_URL = "https://api.cloudflare.com/client/v4";
+
+const RECORD_TYPES = ["A", "AAAA", "CNAME", "TXT", "MX"];
+// only these types can be proxied through Cloudflare
+const PROXIABLE_TYPES = ["A", "AAAA", "CNAME"];
+
+let authHeaders = function (def) {
+    let headers = {"Content-Type": "application/json"};
+    if (def["api-token-secret"]) {
+        headers["Authorization"] = "Bearer " + secret.get(def["api-token-secret"]);
+    } else if (def["api-key-secret"] && def["email"]) {
+        headers["X-Auth-Email"] = def["email"];
+        headers["X-Auth-Key"] = secret.get(def["api-key-secret"]);
+    } else {
+        throw new Error("either api-token-secret or email and api-key-secret must be set");
+    }
+    return headers;
+};
+
+// parseResult unwraps Cloudflare's {success, errors, result} envelope
+let parseResult = function (res) {
+    let body = {};
+    try {
+        body = JSON.parse(res.body);
+    } catch (e) {
+        throw new Error(res.error + ", body " + res.body);
+    }
+    if (res.error || !body.success) {
+        let messages = (body.errors || []).map(function (e) {
+            return e.code + ": " + e.message;
+        });
+        throw new Error((res.error || "request failed") + ", " + messages.join("; "));
+    }
+    return body.result;
+};
+
+let recordBody = function (def) {
+    let type = def["type"].toUpperCase();
+    if (!RECORD_TYPES.includes(type)) {
+        throw new Error("unsupported record type " + def["type"] + ", expected one of " + RECORD_TYPES.join(", "));
+    }
+    if (def["proxied"] && !PROXIABLE_TYPES.includes(type)) {
+        throw new Error(type + " records can't be proxied");
+    }
+
+    let body = {
+        type: type,
+        name: def["name"],
+        content: def["content"],
+        ttl: def["ttl"] || 1,
+        proxied: !!def["proxied"]
+    };
+    if (type === "MX") {
+        if (def["priority"] === undefined) {
+            throw new Error("priority is required for MX records");
+        }
+        body.priority = def["priority"];
+    }
+    if (def["comment"]) {
+        body.comment = def["comment"];
+    }
+    return body;
+};
+
+let findRecords = function (def) {
+    let res = http.get(BASE_URL + "/zones/" + def["zone-id"] + "/dns_records?type=" +
+        encodeURIComponent(def["type"].toUpperCase()) + "&name=" + encodeURIComponent(def["name"]),
+        {"headers": authHeaders(def)});
+    return parseResult(res);
+};
+
+let getRecord = function (def, id) {
+    let res = http.get(BASE_URL + "/zones/" + def["zone-id"] + "/dns_records/" + id, {"headers": authHeaders(def)});
+    return parseResult(res);
+};
+
+// importRecord adopts the record import-id names, which must have the name
+// and type of the definition, and updates it to match the definition
+let importRecord = function (def) {
+    let record = getRecord(def, def["import-id"]);
+    if (record.type !== def["type"].toUpperCase() || record.name.toLowerCase() !== def["name"].toLowerCase()) {
+        throw new Error("DNS record " + def["import-id"] + " is the " + record.type + " record of " + record.name +
+            ", not the " + def["type"].toUpperCase() + " record of " + def["name"]);
+    }
+    cli.output("Importing DNS record " + record.id + " of " + record.name);
+    return updateRecord(def, record.id);
+};
+
+let createRecord = function (def) {
+    let res = http.post(BASE_URL + "/zones/" + def["zone-id"] + "/dns_records",
+        {"headers": authHeaders(def), "body": JSON.stringify(recordBody(def))});
+    return parseResult(res);
+};
+
+let updateRecord = function (def, id) {
+    let res = http.put(BASE_URL + "/zones/" + def["zone-id"] + "/dns_records/" + id,
+        {"headers": authHeaders(def), "body": JSON.stringify(recordBody(def))});
+    return parseResult(res);
+};
+
+let deleteRecord = function (def, id) {
+    let res = http.delete(BASE_URL + "/zones/" + def["zone-id"] + "/dns_records/" + id,
+        {"headers": authHeaders(def)});
+    if (res.error && res.error.includes("response code 404")) {
+        // record is already removed
+        return;
+    }
+    parseResult(res);
+};
+
+// sameContent compares record content the way Cloudflare stores it: host
+// names without case or a trailing dot, TXT values without quotes
+let sameContent = function (type, a, b) {
+    let normalize = function (value) {
+        value = String(value || "");
+        if (type === "TXT") {
+            return value.replace(/^"(.*)"$/, "$1");
+        }
+        return value.toLowerCase().replace(/\.$/, "");
+    };
+    return normalize(a) === normalize(b);
+};
+
+// findOwnRecord returns the record with the same name, type and content as
+// the definition. Other records with the same name belong to someone else,
+// e.g. one of several A records for round-robin DNS, and are left alone.
+let findOwnRecord = function (def) {
+    let type = def["type"].toUpperCase();
+    return findRecords(def).find(function (r) {
+        return sameContent(type, r.content, def["content"]);
+    });
+};
+
+let toState = function (record, adopted) {
+    return {
+        "id": record.id,
+        "adopted": adopted,
+        "zone-id": record.zone_id,
+        "name": record.name,
+        "type": record.type,
+        "content": record.content,
+        "proxied": record.proxied
+    };
+};
+
+function main(def, state, ctx) {
+    let record = {};
+    let adopted = !!state.adopted;
+    switch (ctx.action) {
+        case "create":
+            if (def["import-id"]) {
+                record = importRecord(def);
+                adopted = true;
+                break;
+            }
+            let existing = findOwnRecord(def);
+            if (existing) {
+                // adopt the record with the same name, type and content
+                cli.output("DNS record " + def["name"] + " already exists, updating it");
+                record = updateRecord(def, existing.id);
+                adopted = true;
+            } else {
+                record = createRecord(def);
+            }
+            break;
+        case "update":
+            if (!state.id && def["import-id"]) {
+                record = importRecord(def);
+                adopted = true;
+                break;
+            }
+            if (!state.id) {
+                record = createRecord(def);
+                break;
+            }
+            record = updateRecord(def, state.id);
+            break;
+        case "purge":
+            if (state.id) {
+                deleteRecord(def, state.id);
+            }
+            return;
+        case "check-readiness":
+            let records = findRecords(def);
+            if (!records.some(function (r) {
+                return r.id === state.id;
+            })) {
+                throw new Error("DNS record " + def["name"] + " is not listed in the zone yet");
+            }
+            return state;
+        case "get":
+            cli.output(JSON.stringify(findRecords(def)));
+            return;
+        default:
+            // no action defined
+            return;
+    }
+    return toState(record, adopted);
+}
@@ -0,0 +1,51 @@
+let cli = require("cli");
+let s3 = require("common/s3");
+
+// r2 talks to the account's S3-compatible endpoint, which signs with the
+// region "auto"
+let r2 = s3.client({
+    "name": "Cloudflare R2",
+    "endpoint": function (def) {
+        return "https://" + def["account-id"] + ".r2.cloudflarestorage.com";
+    },
+    "region": function () {
+        return "auto";
+    }
+});
+
+// configureBucket replaces the bucket's CORS and lifecycle rules with the
+// ones in the definition, removing them when none are set
+let configureBucket = function (def) {
+    r2.setCors(def, def["name"], def["cors-rules"]);
+    r2.setLifecycle(def, def["name"], def["lifecycle-rules"]);
+};
+
+let createBucket = function (def) {
+    if (r2.exists(def, def["name"])) {
+        cli.output("Bucket " + def["name"] + " already exists");
+    } else {
+        r2.createBucket(def, def["name"], {"location": def["location-hint"]});
+        cli.output("Created bucket " + def["name"]);
+    }
+    configureBucket(def);
+    return {
+        "name": def["name"],
+        "endpoint": "https://" + def["account-id"] + ".r2.cloudflarestorage.com/" + def["name"]
+    };
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createBucket(def);
+        case "update":
+            configureBucket(def);
+            return state;
+        case "purge":
+            r2.deleteBucket(def, def["name"], def["force-delete"]);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
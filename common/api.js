@@ -0,0 +1,769 @@
+// Provider API clients for the common modules of the entities. A provider
+// module describes its API once with client() and exports the functions it
+// returns, so every entity of the provider sends requests the same way:
+//
+//     let okta = api.client({
+//         "name": "Okta",
+//         "baseUrl": function (def) {
+//             return "https://" + def["domain"] + "/api/v1";
+//         },
+//         "headers": function (def) {
+//             return {"Authorization": "SSWS " + secret.get(def["token-secret"])};
+//         },
+//         "message": function (body) {
+//             return body.errorSummary;
+//         }
+//     });
+//     exports.request = okta.request;
+//
+// Failed requests throw errors starting with the runtime's "response code N",
+// followed by the provider's message.
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+let crypto = require("common/crypto");
+
+// RETRY is the default retry policy: how many times a request is sent at most,
+// the backoff before the second attempt, the longest backoff and how long all
+// attempts of one request may take together, in milliseconds
+const RETRY = {"attempts": 4, "base-delay": 500, "max-delay": 8000, "max-elapsed": 30000};
+
+// requests with these methods can be sent again without changing the outcome
+const IDEMPOTENT_METHODS = ["GET", "HEAD", "OPTIONS", "PUT", "DELETE"];
+
+// requests with these methods only read, they are sent in a dry run too
+const READ_METHODS = ["GET", "HEAD", "OPTIONS"];
+
+// OPERATIONS maps methods to the operations clients set time budgets for
+const OPERATIONS = {"GET": "read", "HEAD": "read", "OPTIONS": "read", "POST": "create", "PUT": "update", "PATCH": "update",
+    "DELETE": "delete"};
+
+// pause waits for ms milliseconds. The entity runtime has no timers, so it
+// watches the clock.
+let pause = function (ms) {
+    let end = Date.now() + ms;
+    while (Date.now() < end) {
+        // wait
+    }
+};
+
+// WAIT is the default of waitFor: the wait before the first check, between
+// checks, the longest wait between checks and the deadline, in milliseconds
+const WAIT = {"initial-delay": 0, "interval": 2000, "max-interval": 10000, "timeout": 300000};
+
+// waitFor calls check until it returns true, waiting longer between calls
+// each time, by half of the interval up to max-interval. Any other value
+// check returns is the status observed so far; when the timeout passes,
+// waitFor throws an error naming what it waited for and the last status.
+// opts overrides the WAIT defaults and may set what, the thing waited for,
+// and onPoll, called with the attempt and status after every check.
+let waitFor = function (check, opts) {
+    opts = Object.assign({"what": "the resource"}, WAIT, opts);
+    let deadline = Date.now() + opts["timeout"];
+    let interval = opts["interval"];
+    pause(opts["initial-delay"]);
+    for (let attempt = 1; ; attempt++) {
+        let status = check();
+        if (status === true) {
+            return;
+        }
+        if (opts.onPoll) {
+            opts.onPoll(attempt, status);
+        }
+        if (Date.now() + interval > deadline) {
+            throw new Error("timed out after " + Math.round(opts["timeout"] / 1000) + "s waiting for " + opts["what"] +
+                ", last status: " + status);
+        }
+        pause(interval);
+        interval = Math.min(opts["max-interval"], Math.round(interval * 1.5));
+    }
+};
+
+// batch calls fn for every item and collects the outcomes instead of
+// stopping at the first failure: {"succeeded": [{"item", "result"}],
+// "failed": [{"item", "error"}]}. The runtime runs an action on one thread,
+// so the items are handled one after the other; fn's requests go through
+// the client's rate limit and retries like any other. opts.name returns the
+// name of an item for the output, which lists every failure.
+let batch = function (items, fn, opts) {
+    opts = opts || {};
+    let result = {"succeeded": [], "failed": []};
+    items.forEach(function (item) {
+        try {
+            result.succeeded.push({"item": item, "result": fn(item)});
+        } catch (e) {
+            result.failed.push({"item": item, "error": e});
+            if (opts.name) {
+                cli.output(opts.name(item) + " failed: " + e.message);
+            }
+        }
+    });
+    return result;
+};
+
+// batchError returns an error listing the failures of a batch of what, e.g.
+// "deploy contexts", carrying them in failed
+let batchError = function (result, what) {
+    let total = result.succeeded.length + result.failed.length;
+    let error = new Error(result.failed.length + " of " + total + " " + what + " failed: " +
+        result.failed.map(function (f) {
+            return f.error.message;
+        }).join("; "));
+    error.failed = result.failed;
+    return error;
+};
+
+// failures returns the failures of a batch as an object from the name of
+// each failed item to its error message, for an entity to keep in its state
+// and retry on the next run
+let failures = function (result, name) {
+    let failed = {};
+    result.failed.forEach(function (f) {
+        failed[name(f.item)] = f.error.message;
+    });
+    return failed;
+};
+
+// TASK describes the task resources of providers that run changes
+// asynchronously: the dot-separated path of the status field, the states of
+// a finished and a failed task and the path of a failed task's error
+const TASK = {"status": "status", "done": ["completed"], "failed": ["failed"], "error": "error"};
+
+// field returns the value at a dot-separated path of an object
+let field = function (value, path) {
+    return path.split(".").reduce(function (v, key) {
+        return v === undefined || v === null ? undefined : v[key];
+    }, value);
+};
+
+// taskStatus returns true for a finished task, throws the provider's error
+// for a failed one and returns the status of one still running. kind
+// overrides the TASK field names and states, as providers name them
+// differently.
+let taskStatus = function (task, kind) {
+    kind = Object.assign({}, TASK, kind);
+    let status = field(task, kind["status"]);
+    if (kind["done"].includes(status)) {
+        return true;
+    }
+    if (kind["failed"].includes(status)) {
+        throw new Error("task " + status + ": " + (field(task, kind["error"]) || "no error given"));
+    }
+    return status;
+};
+
+// header returns a response header regardless of its case. The runtime may
+// pass values as lists, the values of a repeated header are joined with
+// commas.
+let header = function (res, name) {
+    let headers = res.headers || {};
+    for (let key in headers) {
+        if (key.toLowerCase() === name.toLowerCase()) {
+            let value = headers[key];
+            return Array.isArray(value) ? value.join(", ") : value;
+        }
+    }
+    return undefined;
+};
+
+// retryAfter returns the wait a Retry-After header asks for, in seconds or
+// as an HTTP date, in milliseconds, or -1 without one
+let retryAfter = function (res) {
+    let value = header(res, "Retry-After");
+    if (value === undefined || value === "") {
+        return -1;
+    }
+    if (/^\d+$/.test(String(value).trim())) {
+        return parseInt(value, 10) * 1000;
+    }
+    let date = Date.parse(value);
+    return isNaN(date) ? -1 : Math.max(0, date - Date.now());
+};
+
+// transient tells whether a failed request may succeed when sent again:
+// network errors, which have no status code, 429 and 5xx responses
+let transient = function (res) {
+    return !res.statusCode || res.statusCode === 429 || res.statusCode >= 500;
+};
+
+// backoff returns the wait before the next attempt: the Retry-After of the
+// response, or an exponential backoff with full jitter
+let backoff = function (retry, attempt, res) {
+    let wait = retryAfter(res);
+    if (wait >= 0) {
+        return wait;
+    }
+    let ceiling = Math.min(retry["max-delay"], retry["base-delay"] * Math.pow(2, attempt - 1));
+    return Math.floor(Math.random() * ceiling);
+};
+
+// SENSITIVE lists the parts of key names whose values are never printed, in
+// lower case and without dashes or underscores
+const SENSITIVE = ["password", "secret", "token", "apikey", "authorization", "privatekey"];
+
+// sanitize returns a copy of value, objects and lists at any depth, with the
+// values of sensitive keys replaced by ***. A key is sensitive when its name
+// contains one of SENSITIVE or extraKeys, regardless of case, dashes and
+// underscores, so api-key, client_secret and authToken are all caught.
+let sanitize = function (value, extraKeys) {
+    let parts = SENSITIVE.concat((extraKeys || []).map(function (key) {
+        return key.toLowerCase().replace(/[-_]/g, "");
+    }));
+    let clean = function (v) {
+        if (Array.isArray(v)) {
+            return v.map(clean);
+        }
+        if (v === null || typeof v !== "object") {
+            return v;
+        }
+        let out = {};
+        for (let key in v) {
+            let name = key.toLowerCase().replace(/[-_]/g, "");
+            out[key] = parts.some(function (part) {
+                return name.includes(part);
+            }) ? "***" : clean(v[key]);
+        }
+        return out;
+    };
+    return clean(value);
+};
+
+// LEVELS are the verbosity levels of a definition's verbosity field, from
+// least to most output: info prints what the entity does, debug adds every
+// request with its status and duration, trace adds the sanitized bodies
+const LEVELS = ["silent", "info", "debug", "trace"];
+
+// log prints message when the definition's verbosity, info by default,
+// includes level
+let log = function (def, level, message) {
+    let verbosity = LEVELS.indexOf((def && def["verbosity"]) || "info");
+    if (verbosity < 0) {
+        throw new Error("verbosity must be one of " + LEVELS.join(", ") + ", got " + def["verbosity"]);
+    }
+    if (LEVELS.indexOf(level) <= verbosity) {
+        cli.output(message);
+    }
+};
+
+// traceBody returns a response body for the trace output, sanitized when it
+// is JSON and left out when it isn't, as it can't be told what it holds
+let traceBody = function (res, extraKeys) {
+    if (!res.body) {
+        return "(empty body)";
+    }
+    try {
+        return JSON.stringify(sanitize(JSON.parse(res.body), extraKeys));
+    } catch (e) {
+        return "(" + res.body.length + " bytes, not JSON)";
+    }
+};
+
+// limiting turns client-side rate limits on and off, tests turn them off
+let limiting = true;
+
+let setRateLimiting = function (enabled) {
+    limiting = enabled;
+};
+
+// bucket returns a token bucket refilling at perSecond tokens a second and
+// holding burst at most. take waits until a token is free and uses it, so
+// requests queue up instead of running into the provider's 429s.
+let bucket = function (perSecond, burst) {
+    let tokens = burst;
+    let last = Date.now();
+    return {
+        "take": function () {
+            let now = Date.now();
+            tokens = Math.min(burst, tokens + (now - last) * perSecond / 1000);
+            last = now;
+            if (tokens < 1) {
+                pause(Math.ceil((1 - tokens) * 1000 / perSecond));
+                tokens = 1;
+                last = Date.now();
+            }
+            tokens -= 1;
+        }
+    };
+};
+
+// apiError returns the error of a failed request. Its message is the
+// runtime's "response code N" followed by the provider's message, or the raw
+// body when that can't be parsed, and it carries
+//
+//   status    the HTTP status, 0 for a network error
+//   provider  the name of the provider
+//   code      the provider's error code, when config.code finds one
+//   path      the path of the request
+//
+// so that callers can tell failures apart without matching messages. It stays
+// a plain Error, as Monk prints errors with their name.
+let apiError = function (config, res, path) {
+    let message = res.body;
+    let code;
+    try {
+        let body = config.parseError ? config.parseError(res.body) : JSON.parse(res.body);
+        message = config.message(body) || res.body;
+        code = config.code ? config.code(body) : undefined;
+    } catch (e) {
+        // keep the raw body
+    }
+    let error = new Error((res.error + ", " + (message || "")).replace(/, $/, ""));
+    error.status = res.statusCode || 0;
+    error.provider = config.name;
+    error.code = code;
+    error.path = path;
+    return error;
+};
+
+// isNotFound tells whether an error is a 404 of a provider API, e.g. for a
+// resource that was deleted already
+let isNotFound = function (error) {
+    return error.status === 404 || (error.status === undefined && /response code 404\b/.test(error.message));
+};
+
+// parseChallenge returns the fields of a WWW-Authenticate Digest challenge,
+// e.g. realm, nonce, qop and opaque, or null for another scheme
+let parseChallenge = function (value) {
+    let match = /^\s*Digest\s+(.*)$/i.exec(value || "");
+    if (!match) {
+        return null;
+    }
+    let fields = {};
+    let re = /([\w-]+)\s*=\s*(?:"((?:[^"\\]|\\.)*)"|([^\s,]*))/g;
+    let field;
+    while ((field = re.exec(match[1])) !== null) {
+        fields[field[1].toLowerCase()] = field[2] !== undefined ? field[2].replace(/\\(.)/g, "$1") : field[3];
+    }
+    return fields.nonce ? fields : null;
+};
+
+// digestResponse returns the response of HTTP digest authentication (RFC 7616)
+// to a challenge for a request: a hash of the credentials, the nonce and the
+// method and URI. f holds username, password, realm, nonce, method, uri,
+// algorithm (MD5 or SHA-256) and, with quality of protection, qop, nc and
+// cnonce.
+let digestResponse = function (f) {
+    let hash = function (s) {
+        return crypto.toHex(/^SHA-256$/i.test(f.algorithm || "") ? crypto.sha256(s) : crypto.md5(s));
+    };
+    let ha1 = hash(f.username + ":" + f.realm + ":" + f.password);
+    let ha2 = hash(f.method + ":" + f.uri);
+    if (!f.qop) {
+        return hash(ha1 + ":" + f.nonce + ":" + ha2);
+    }
+    return hash([ha1, f.nonce, f.nc, f.cnonce, f.qop, ha2].join(":"));
+};
+
+// client returns the request functions of a provider API. config holds:
+//
+//   name         the provider, e.g. "Okta"
+//   baseUrl      the URL paths are relative to, or a function of the definition
+//                returning it; "" when callers pass full URLs
+//   url          optional function (def, url) adjusting every URL, e.g. to add
+//                a query parameter
+//   headers      function of the definition returning the authentication and
+//                other headers of every request
+//   message      function extracting the error message from a parsed error body
+//   code         optional function extracting the provider's error code from it
+//   encode       optional function encoding request bodies, JSON by default
+//   contentType  Content-Type of request bodies, application/json by default
+//   retry        optional overrides of the RETRY policy
+//   timeouts     optional time budgets of "read", "create", "update" and
+//                "delete" requests in milliseconds, each the retry policy's
+//                max-elapsed when unset
+//   rateLimit    optional {"per-second": n, "burst": m} limiting the requests
+//                of the action to n a second, after a burst of m
+//   idempotencyHeader
+//                the header the provider takes idempotency keys in, for
+//                providers that support them
+//   validate     optional {"path": p, "credentials": fn} checking the
+//                credentials before the first change: a GET of p, e.g. the
+//                current user, and fn(def) describing where they come from
+//                for the error when the provider rejects them
+//   cacheReads   optional, true to answer repeated GETs of the same URL in an
+//                action from the first response
+//   sensitive    optional names of body fields sanitize hides besides the
+//                SENSITIVE ones, e.g. the auth string of a connection
+//   parseError   optional function parsing an error body for message and
+//                code, JSON.parse by default, e.g. for APIs answering in XML
+//   sign         optional function (def, method, url, headers, body)
+//                returning the headers of a request with a signature over
+//                it, e.g. SigV4; it signs every attempt anew
+//   authQuery    optional function of the definition returning query
+//                parameters that authenticate a request, e.g. a SAS token;
+//                they are added to the URL sent but not to the one printed
+//   digest       optional function of the definition returning the
+//                {"username": u, "password": p} of HTTP digest
+//                authentication, or null when the definition authenticates
+//                with the headers, e.g. a bearer token, instead
+//
+// A create that got no answer, a 5xx or a network error, may still have
+// reached the provider, and sending it again could make a duplicate. How that
+// is avoided depends on the provider:
+//
+//   - Stripe takes an Idempotency-Key header and answers a repeated key with
+//     the object of the first request, so stripe/common sets
+//     idempotencyHeader and creates with create(), which retries.
+//   - The others have no such header. Their creates aren't retried, and the
+//     entities look for the resource before creating it and adopt it, e.g.
+//     cloudflare/dns-record, github/repository, mongodb-atlas/project,
+//     neon/branch, okta/group, vercel/project and the snowflake objects.
+let client = function (config) {
+    let retry = Object.assign({}, RETRY, config.retry);
+    let timeouts = Object.assign({
+        "read": retry["max-elapsed"],
+        "create": retry["max-elapsed"],
+        "update": retry["max-elapsed"],
+        "delete": retry["max-elapsed"]
+    }, config.timeouts);
+    let limit = config.rateLimit ? bucket(config.rateLimit["per-second"], config.rateLimit["burst"] || 1) : null;
+    let encode = config.encode || JSON.stringify;
+
+    // urlOf returns the URL of a path. A definition's api-url replaces the
+    // scheme, host and port of every URL, to send the requests to a mock
+    // server or a private deployment of the provider's API.
+    let urlOf = function (def, path) {
+        let base = typeof config.baseUrl === "function" ? config.baseUrl(def) : config.baseUrl;
+        // next links of paginated lists are full URLs
+        let url = /^https?:\/\//.test(path) ? path : base + path;
+        url = config.url ? config.url(def, url) : url;
+        if (def && def["api-url"]) {
+            url = def["api-url"].replace(/\/+$/, "") + url.replace(/^https?:\/\/[^\/]+/, "");
+        }
+        return url;
+    };
+
+    // reads holds the responses of GETs in this action by URL and headers,
+    // when the client caches reads
+    let reads = {};
+
+    // pathOf returns a URL without its query
+    let pathOf = function (url) {
+        return url.split("?")[0];
+    };
+
+    // invalidate drops the cached reads related to a URL that changed: its
+    // own, those of resources below it, e.g. /branches/1/endpoints after a
+    // change of /branches/1, and those above it, e.g. the list /branches
+    let invalidate = function (url) {
+        let changed = pathOf(url);
+        for (let key in reads) {
+            let cached = pathOf(reads[key].url);
+            if (cached === changed || cached.indexOf(changed + "/") === 0 || changed.indexOf(cached + "/") === 0) {
+                delete reads[key];
+            }
+        }
+    };
+
+    // cooldownUntil is when the provider's rate limit, announced by a 429
+    // with Retry-After, lets requests through again. Every request of the
+    // action waits for it, instead of each running into the limit itself.
+    let cooldownUntil = 0;
+
+    let coolDown = function (def, res) {
+        let wait = retryAfter(res);
+        if (res.statusCode !== 429 || wait < 0 || Date.now() + wait <= cooldownUntil) {
+            return;
+        }
+        cooldownUntil = Date.now() + wait;
+        log(def, "debug", config.name + " rate limit reached, pausing its requests for " + Math.ceil(wait / 1000) +
+            "s as Retry-After asks");
+    };
+
+    // challenges holds the last digest challenge of each server and user, so
+    // requests after the first answer its nonce right away instead of being
+    // challenged again
+    let challenges = {};
+
+    // digestAuthorization returns the Authorization header answering the
+    // cached challenge for a request, counting the uses of its nonce
+    let digestAuthorization = function (credentials, challenge, method, url) {
+        challenge.nc = (challenge.nc || 0) + 1;
+        let f = {
+            "username": credentials.username,
+            "password": credentials.password,
+            "realm": challenge.realm || "",
+            "nonce": challenge.nonce,
+            "method": method,
+            "uri": url.replace(/^https?:\/\/[^\/]+/, "") || "/",
+            "algorithm": challenge.algorithm
+        };
+        if (/(^|,)\s*auth\s*(,|$)/.test(challenge.qop || "")) {
+            f.qop = "auth";
+            f.nc = ("0000000" + challenge.nc.toString(16)).slice(-8);
+            f.cnonce = crypto.toHex(crypto.randomBytes(8));
+        }
+        let fields = ["username=\"" + f.username + "\"", "realm=\"" + f.realm + "\"", "nonce=\"" + f.nonce + "\"",
+            "uri=\"" + f.uri + "\"", "response=\"" + digestResponse(f) + "\""];
+        if (challenge.algorithm) {
+            fields.push("algorithm=" + challenge.algorithm);
+        }
+        if (challenge.opaque !== undefined) {
+            fields.push("opaque=\"" + challenge.opaque + "\"");
+        }
+        if (f.qop) {
+            fields.push("qop=" + f.qop, "nc=" + f.nc, "cnonce=\"" + f.cnonce + "\"");
+        }
+        return "Digest " + fields.join(", ");
+    };
+
+    // validated holds the credentials that passed validation in this action
+    let validated = {};
+
+    // validateCredentials reads config.validate's path before the first
+    // change made with a definition's credentials, so wrong credentials fail
+    // with an error that says which ones instead of deep within a create.
+    // Only a 401 counts as rejected; a token lacking the scope to read the
+    // path (403) or a failure of the provider leave the check to the change.
+    let validateCredentials = function (def) {
+        let key = urlOf(def, "") + JSON.stringify(config.headers(def));
+        if (!config.validate || validated[key]) {
+            return;
+        }
+        try {
+            send(def, "get", config.validate.path);
+        } catch (e) {
+            if (e.status === 401) {
+                throw new Error(config.name + " rejected " + config.validate.credentials(def) + " (" + e.message +
+                    "), check that it is current and has not been revoked");
+            }
+        }
+        validated[key] = true;
+    };
+
+    // sendDigest sends a request with digest authentication. It answers the
+    // cached challenge of the server when there is one; a 401 with a new
+    // challenge, the first one or one for a nonce gone stale, is answered
+    // and the request sent once more. A 401 means the request wasn't
+    // processed, so even a create can be sent again.
+    let sendDigest = function (def, credentials, url, req) {
+        let key = urlOf(def, "").replace(/^(https?:\/\/[^\/]+).*$/, "$1") + " " + credentials.username;
+        let answer = function (challenge) {
+            return Object.assign({}, req, {
+                "headers": Object.assign({}, req.headers, {
+                    "Authorization": digestAuthorization(credentials, challenge, req.method, url)
+                })
+            });
+        };
+        let res = http.do(url, challenges[key] ? answer(challenges[key]) : req);
+        let challenge = res.statusCode === 401 ? parseChallenge(header(res, "WWW-Authenticate")) : null;
+        if (!challenge || (challenges[key] && challenges[key].nonce === challenge.nonce)) {
+            return res;
+        }
+        challenges[key] = challenge;
+        return http.do(url, answer(challenge));
+    };
+
+    // send sends a request and returns the runtime's response. Requests that
+    // failed transiently are sent again after a backoff when they are
+    // idempotent, until the policy's attempts or the time budget of the
+    // operation run out. The error of the last attempt says how many were
+    // made. Each attempt asks the runtime to give up after what is left of
+    // the budget. opts.operation picks the budget of a request whose method
+    // doesn't tell its operation, e.g. a POST that updates, and opts.timeout
+    // sets one for a single slow call.
+    //
+    // A client with cacheReads answers a GET it sent before in the action
+    // from the cache, unless opts.cache is false, as for polling; any other
+    // request drops the cached reads of related paths.
+    //
+    // With dry-run set in the definition, send prints the first request that
+    // would change something instead of sending it and fails the action. Monk
+    // saves the state an action returns, so the action can't go on with a
+    // made-up response; failing keeps the state as it was.
+    let send = function (def, method, path, body, opts) {
+        opts = opts || {};
+        method = method.toUpperCase();
+        let url = urlOf(def, path);
+        let req = {"method": method, "headers": Object.assign({}, config.headers(def), opts.headers)};
+        if (body !== undefined && body !== null) {
+            req.headers["Content-Type"] = config.contentType || "application/json";
+            req.body = encode(body);
+        }
+        let cacheKey = url + " " + JSON.stringify(req.headers);
+        let cacheable = config.cacheReads === true && method === "GET" && opts.cache !== false;
+        if (cacheable && reads[cacheKey]) {
+            return reads[cacheKey].res;
+        }
+        if (!READ_METHODS.includes(method)) {
+            validateCredentials(def);
+            invalidate(url);
+        }
+        if (def && def["dry-run"] === true && !READ_METHODS.includes(method)) {
+            let shown = req.body ? "\n" + encode(sanitize(body, config.sensitive)) : "";
+            log(def, "info", "Dry run: " + method + " " + url + shown);
+            throw new Error("dry run, stopped before " + method + " " + url + " and changed nothing");
+        }
+        let digest = config.digest ? config.digest(def) : null;
+        let authQuery = config.authQuery ? config.authQuery(def) : "";
+        let target = authQuery ? url + (url.includes("?") ? "&" : "?") + authQuery : url;
+        let retryable = IDEMPOTENT_METHODS.includes(method) || opts.idempotent === true;
+        let budget = opts.timeout || timeouts[opts.operation || OPERATIONS[method] || "read"];
+        let started = Date.now();
+        for (let attempt = 1; ; attempt++) {
+            if (cooldownUntil > Date.now()) {
+                pause(cooldownUntil - Date.now());
+            }
+            if (limit && limiting) {
+                limit.take();
+            }
+            req.timeout = Math.max(1, Math.ceil((budget - (Date.now() - started)) / 1000));
+            if (req.body !== undefined) {
+                log(def, "trace", method + " " + url + "\n" + JSON.stringify(sanitize(body, config.sensitive)));
+            }
+            let sent = Date.now();
+            let res;
+            if (digest) {
+                res = sendDigest(def, digest, url, req);
+            } else if (config.sign) {
+                res = http.do(target, Object.assign({}, req, {"headers": config.sign(def, method, target, req.headers, req.body)}));
+            } else {
+                res = http.do(target, req);
+            }
+            log(def, "debug", method + " " + url + " " + (res.statusCode || res.error) + " (" + (Date.now() - sent) + "ms)");
+            log(def, "trace", traceBody(res, config.sensitive));
+            if (!res.error) {
+                if (cacheable) {
+                    reads[cacheKey] = {"url": url, "res": res};
+                }
+                return res;
+            }
+            coolDown(def, res);
+            let wait = backoff(retry, attempt, res);
+            if (!retryable || !transient(res) || attempt >= retry["attempts"] ||
+                Date.now() - started + wait > budget) {
+                let error = apiError(config, res, path);
+                if (attempt > 1) {
+                    error.message += " (after " + attempt + " attempts)";
+                }
+                throw error;
+            }
+            pause(wait);
+        }
+    };
+
+    // request sends a request and returns its parsed JSON body, {} when empty
+    let request = function (def, method, path, body, opts) {
+        let res = send(def, method, path, body, opts);
+        return res.body ? JSON.parse(res.body) : {};
+    };
+
+    // create posts a new resource with an idempotency key, so that it can be
+    // retried like an idempotent request. The key is fresh for each call
+    // unless opts.key sets one; every attempt of the call sends the same key.
+    // The runtime doesn't save the state of a failed action, so a key can't
+    // be carried over to the next run in state.
+    let create = function (def, path, body, opts) {
+        if (!config.idempotencyHeader) {
+            throw new Error(config.name + " takes no idempotency keys, look for an existing resource before creating one");
+        }
+        opts = Object.assign({}, opts);
+        let headers = {};
+        headers[config.idempotencyHeader] = opts.key || "monk-" + secret.randString(32);
+        return request(def, "post", path, body, {
+            "headers": Object.assign(headers, opts.headers),
+            "idempotent": true
+        });
+    };
+
+    // remove deletes the resource at path. A resource that is gone already
+    // counts as deleted, so a delete of something removed out of band doesn't
+    // leave the entity stuck; entities for which a missing resource is an
+    // error pass {"missingOk": false}.
+    let remove = function (def, path, opts) {
+        opts = Object.assign({"missingOk": true}, opts);
+        try {
+            send(def, "delete", path, undefined, opts);
+        } catch (e) {
+            if (!opts.missingOk || !isNotFound(e)) {
+                throw e;
+            }
+            log(def, "info", config.name + " " + path + " was already deleted");
+        }
+    };
+
+    // listAll returns the items of every page of a list. opts.items is the
+    // dot-separated path of the items in a page, the page itself when unset.
+    // opts.pages picks how the provider paginates:
+    //
+    //   "link"    a Link header with rel="next", e.g. Okta and GitHub
+    //   "next"    the URL of the next page in the field opts.next of a page,
+    //             relative ones resolved against opts.origin
+    //   "cursor"  the cursor in the field opts.next of a page, sent back as
+    //             the query parameter opts.param
+    //   "page"    page numbers from 1 in the query parameter opts.param
+    //
+    // Listing stops at the last page or at the first without items.
+    let listAll = function (def, path, opts) {
+        opts = Object.assign({"pages": "link", "param": opts && opts.pages === "page" ? "page" : "cursor"}, opts);
+        let join = function (url, key, value) {
+            return url + (url.includes("?") ? "&" : "?") + key + "=" + encodeURIComponent(value);
+        };
+        let all = [];
+        let url = opts.pages === "page" ? join(path, opts.param, 1) : path;
+        for (let page = 1; url; page++) {
+            let res = send(def, "get", url);
+            let body = res.body ? JSON.parse(res.body) : [];
+            let items = (opts.items ? field(body, opts.items) : body) || [];
+            if (items.length === 0) {
+                break;
+            }
+            all = all.concat(items);
+            let next;
+            switch (opts.pages) {
+                case "link":
+                    next = /<([^>]+)>\s*;\s*rel="?next"?/.exec(header(res, "Link") || "");
+                    url = next ? next[1] : "";
+                    break;
+                case "next":
+                    next = field(body, opts.next);
+                    url = next ? (/^https?:/.test(next) ? next : opts.origin + next) : "";
+                    break;
+                case "cursor":
+                    next = field(body, opts.next);
+                    url = next ? join(path, opts.param, next) : "";
+                    break;
+                case "page":
+                    url = join(path, opts.param, page + 1);
+                    break;
+                default:
+                    throw new Error("unknown pagination " + opts.pages);
+            }
+        }
+        return all;
+    };
+
+    // checkTask reads the task at path once and returns what taskStatus does,
+    // for readiness checks that leave the waiting to Monk
+    let checkTask = function (def, path, kind) {
+        return taskStatus(request(def, "get", path, undefined, {"cache": false}), kind);
+    };
+
+    // pollTask waits for the task at path to finish, with waitFor and its
+    // opts, and returns the finished task
+    let pollTask = function (def, path, kind, opts) {
+        let task;
+        waitFor(function () {
+            task = request(def, "get", path, undefined, {"cache": false});
+            return taskStatus(task, kind);
+        }, Object.assign({"what": "task " + path}, opts));
+        return task;
+    };
+
+    return {"send": send, "request": request, "create": create, "remove": remove, "listAll": listAll, "checkTask": checkTask, "pollTask": pollTask};
+};
+
+exports.RETRY = RETRY;
+exports.pause = pause;
+exports.setRateLimiting = setRateLimiting;
+exports.waitFor = waitFor;
+exports.taskStatus = taskStatus;
+exports.batch = batch;
+exports.batchError = batchError;
+exports.failures = failures;
+exports.header = header;
+exports.sanitize = sanitize;
+exports.log = log;
+exports.isNotFound = isNotFound;
+exports.digestResponse = digestResponse;
+exports.client = client;
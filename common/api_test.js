@@ -0,0 +1,710 @@
+// Tests for common/api: node common/api_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+let setup = function (retry) {
+    let rt = testing.runtime();
+    let api = rt.require("common/api");
+    let client = api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function (def) {
+            return {"Authorization": "Bearer " + def["token"]};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "retry": Object.assign({"base-delay": 1, "max-delay": 2}, retry)
+    });
+    return {"rt": rt, "api": api, "client": client};
+};
+
+// responses returns a handler answering with the given responses in turn
+let responses = function (list) {
+    return function () {
+        return list.shift();
+    };
+};
+
+test("request sends JSON with the provider headers", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 200, "body": "{\"id\":\"1\"}"};
+    };
+    assert.deepStrictEqual(t.client.request({"token": "abc"}, "post", "/things", {"name": "a"}), {"id": "1"});
+    let req = t.rt.requests[0];
+    assert.strictEqual(req.method, "POST");
+    assert.strictEqual(req.url, "https://api.test/things");
+    assert.strictEqual(req.headers["Authorization"], "Bearer abc");
+    assert.strictEqual(req.headers["Content-Type"], "application/json");
+    assert.strictEqual(req.body, "{\"name\":\"a\"}");
+});
+
+test("an empty body parses as an empty object", function () {
+    let t = setup();
+    assert.deepStrictEqual(t.client.request({}, "delete", "/things/1"), {});
+});
+
+test("transient failures of idempotent requests are retried", function () {
+    let t = setup();
+    t.rt.handler = responses([
+        {"statusCode": 503, "body": ""},
+        {"statusCode": 0, "error": "dial tcp: connection refused"},
+        {"statusCode": 429, "body": ""},
+        {"statusCode": 200, "body": "{\"ok\":true}"}
+    ]);
+    assert.deepStrictEqual(t.client.request({}, "get", "/things"), {"ok": true});
+    assert.strictEqual(t.rt.requests.length, 4);
+});
+
+test("the last error says how many attempts were made", function () {
+    let t = setup({"attempts": 3});
+    t.rt.handler = function () {
+        return {"statusCode": 502, "body": "{\"message\":\"bad gateway\"}"};
+    };
+    assert.throws(function () {
+        t.client.request({}, "put", "/things/1", {});
+    }, /^Error: response code 502, bad gateway \(after 3 attempts\)$/);
+    assert.strictEqual(t.rt.requests.length, 3);
+});
+
+test("client errors are not retried", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 404, "body": "{\"message\":\"not found\"}"};
+    };
+    assert.throws(function () {
+        t.client.request({}, "get", "/things/1");
+    }, /^Error: response code 404, not found$/);
+    assert.strictEqual(t.rt.requests.length, 1);
+});
+
+test("POST is only retried when marked idempotent", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 500, "body": ""};
+    };
+    assert.throws(function () {
+        t.client.request({}, "post", "/things", {});
+    }, /^Error: response code 500$/);
+    assert.strictEqual(t.rt.requests.length, 1);
+
+    t.rt.handler = responses([{"statusCode": 500, "body": ""}, {"statusCode": 201, "body": "{}"}]);
+    t.client.request({}, "post", "/things", {}, {"idempotent": true});
+    assert.strictEqual(t.rt.requests.length, 3);
+});
+
+test("Retry-After sets the wait before the next attempt", function () {
+    let t = setup();
+    t.rt.handler = responses([
+        {"statusCode": 429, "body": "", "headers": {"Retry-After": ["1"]}},
+        {"statusCode": 200, "body": "{}"}
+    ]);
+    let started = Date.now();
+    t.client.request({}, "get", "/things");
+    assert.ok(Date.now() - started >= 1000);
+});
+
+test("a 429 with Retry-After pauses the other requests of the client", function () {
+    let t = setup();
+    t.rt.handler = responses([
+        {"statusCode": 429, "body": "", "headers": {"Retry-After": "1"}},
+        {"statusCode": 200, "body": "{}"}
+    ]);
+    assert.throws(function () {
+        t.client.request({"verbosity": "debug"}, "post", "/things", {});
+    }, /^Error: response code 429$/);
+    let started = Date.now();
+    t.client.request({}, "get", "/things/1");
+    assert.ok(Date.now() - started >= 900);
+    assert.strictEqual(t.rt.output[1], "Test rate limit reached, pausing its requests for 1s as Retry-After asks");
+});
+
+test("a retry that would run past max-elapsed is not made", function () {
+    let t = setup({"max-elapsed": 500});
+    t.rt.handler = function () {
+        return {"statusCode": 503, "body": "", "headers": {"retry-after": "5"}};
+    };
+    let started = Date.now();
+    assert.throws(function () {
+        t.client.request({}, "get", "/things");
+    }, /^Error: response code 503$/);
+    assert.ok(Date.now() - started < 500);
+});
+
+test("waitFor returns once the check passes", function () {
+    let t = setup();
+    let statuses = ["pending", "building", true];
+    let polls = [];
+    t.api.waitFor(function () {
+        return statuses.shift();
+    }, {"interval": 1, "onPoll": function (attempt, status) {
+        polls.push(attempt + " " + status);
+    }});
+    assert.deepStrictEqual(polls, ["1 pending", "2 building"]);
+});
+
+test("waitFor times out with the last status", function () {
+    let t = setup();
+    let checks = 0;
+    assert.throws(function () {
+        t.api.waitFor(function () {
+            checks++;
+            return "status " + checks;
+        }, {"what": "the deployment", "interval": 10, "max-interval": 20, "timeout": 100});
+    }, function (e) {
+        return e.message === "timed out after 0s waiting for the deployment, last status: status " + checks;
+    });
+    assert.ok(checks >= 3);
+});
+
+test("taskStatus reads the provider's status vocabulary", function () {
+    let t = setup();
+    let kind = {"status": "operation.status", "done": ["finished"], "failed": ["error"], "error": "operation.error"};
+    assert.strictEqual(t.api.taskStatus({"operation": {"status": "running"}}, kind), "running");
+    assert.strictEqual(t.api.taskStatus({"operation": {"status": "finished"}}, kind), true);
+    assert.throws(function () {
+        t.api.taskStatus({"operation": {"status": "error", "error": "disk full"}}, kind);
+    }, /^Error: task error: disk full$/);
+});
+
+test("pollTask waits for the task to complete", function () {
+    let t = setup();
+    let statuses = ["received", "processing", "completed"];
+    t.rt.handler = function () {
+        return {"statusCode": 200, "body": JSON.stringify({"status": statuses.shift(), "result": 7})};
+    };
+    let task = t.client.pollTask({}, "/tasks/1", {}, {"interval": 1});
+    assert.strictEqual(task.result, 7);
+    assert.strictEqual(t.rt.requests.length, 3);
+});
+
+test("pollTask fails with the provider error", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 200, "body": "{\"status\":\"failed\",\"error\":\"quota exceeded\"}"};
+    };
+    assert.throws(function () {
+        t.client.pollTask({}, "/tasks/1", {}, {"interval": 1});
+    }, /^Error: task failed: quota exceeded$/);
+});
+
+test("listAll follows Link headers", function () {
+    let t = setup();
+    t.rt.handler = function (req) {
+        if (req.url.endsWith("after=2")) {
+            return {"statusCode": 200, "body": "[{\"id\":3}]", "headers": {"Link": ["<https://api.test/items?after=2>; rel=\"self\""]}};
+        }
+        return {"statusCode": 200, "body": "[{\"id\":1},{\"id\":2}]", "headers": {"link": [
+            "<https://api.test/items>; rel=\"self\"",
+            "<https://api.test/items?after=2>; rel=\"next\""
+        ]}};
+    };
+    assert.deepStrictEqual(t.client.listAll({}, "/items"), [{"id": 1}, {"id": 2}, {"id": 3}]);
+});
+
+test("listAll follows next links and cursors in the body", function () {
+    let t = setup();
+    t.rt.handler = function (req) {
+        let second = req.url.includes("page=2") || req.url.includes("cursor=c2");
+        return {"statusCode": 200, "body": JSON.stringify({
+            "data": {"items": second ? ["b"] : ["a"]},
+            "meta": {"next": second ? null : "/items?page=2", "cursor": second ? "" : "c2"}
+        })};
+    };
+    assert.deepStrictEqual(t.client.listAll({}, "/items", {"pages": "next", "items": "data.items", "next": "meta.next",
+        "origin": "https://api.test"}), ["a", "b"]);
+    assert.strictEqual(t.rt.requests[1].url, "https://api.test/items?page=2");
+    assert.deepStrictEqual(t.client.listAll({}, "/items?q=x", {"pages": "cursor", "items": "data.items",
+        "next": "meta.cursor"}), ["a", "b"]);
+    assert.strictEqual(t.rt.requests[3].url, "https://api.test/items?q=x&cursor=c2");
+});
+
+test("listAll counts pages until one comes back empty", function () {
+    let t = setup();
+    t.rt.handler = function (req) {
+        let page = parseInt(/page=(\d+)/.exec(req.url)[1], 10);
+        return {"statusCode": 200, "body": JSON.stringify(page <= 2 ? [page] : [])};
+    };
+    assert.deepStrictEqual(t.client.listAll({}, "/items", {"pages": "page"}), [1, 2]);
+    assert.strictEqual(t.rt.requests.length, 3);
+});
+
+test("rateLimit spaces requests out after the burst", function () {
+    let t = setup();
+    let limited = t.api.client({
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function () {
+            return "";
+        },
+        "rateLimit": {"per-second": 20, "burst": 2}
+    });
+    let started = Date.now();
+    for (let i = 0; i < 6; i++) {
+        limited.request({}, "get", "/items");
+    }
+    // two requests go out at once, the other four wait 50ms each
+    assert.ok(Date.now() - started >= 190);
+
+    t.api.setRateLimiting(false);
+    started = Date.now();
+    for (let i = 0; i < 6; i++) {
+        limited.request({}, "get", "/items");
+    }
+    assert.ok(Date.now() - started < 50);
+});
+
+test("create resends with the same idempotency key", function () {
+    let t = setup();
+    let client = t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "idempotencyHeader": "Idempotency-Key",
+        "retry": {"base-delay": 1, "max-delay": 2}
+    });
+    t.rt.handler = responses([{"statusCode": 0, "error": "connection reset"}, {"statusCode": 200, "body": "{\"id\":\"1\"}"}]);
+    assert.deepStrictEqual(client.create({}, "/things", {"name": "a"}), {"id": "1"});
+    let keys = t.rt.requests.map(function (r) {
+        return r.headers["Idempotency-Key"];
+    });
+    assert.strictEqual(keys.length, 2);
+    assert.ok(/^monk-\w{32}$/.test(keys[0]));
+    assert.strictEqual(keys[1], keys[0]);
+
+    client.create({}, "/things", {"name": "b"});
+    assert.notStrictEqual(t.rt.requests[2].headers["Idempotency-Key"], keys[0]);
+});
+
+test("create needs a provider that takes idempotency keys", function () {
+    let t = setup();
+    assert.throws(function () {
+        t.client.create({}, "/things", {});
+    }, /Test takes no idempotency keys/);
+});
+
+test("a dry run reads but stops before the first change", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 200, "body": "{\"name\":\"old\"}"};
+    };
+    let def = {"token": "abc", "dry-run": true};
+    assert.deepStrictEqual(t.client.request(def, "get", "/things/1"), {"name": "old"});
+    assert.throws(function () {
+        t.client.request(def, "patch", "/things/1", {"name": "new"});
+    }, /^Error: dry run, stopped before PATCH https:\/\/api.test\/things\/1 and changed nothing$/);
+    assert.strictEqual(t.rt.requests.length, 1);
+    assert.deepStrictEqual(t.rt.output, ["Dry run: PATCH https://api.test/things/1\n{\"name\":\"new\"}"]);
+});
+
+test("sanitize hides sensitive values at any depth", function () {
+    let t = setup();
+    let def = {
+        "name": "cache",
+        "password": "hunter2",
+        "credentials": {"apiKey": "key-123", "client_secret": "s3cr3t", "user": "admin"},
+        "connections": [{"auth-token": "tok-456", "host": "db"}],
+        "Authorization": "Bearer abc",
+        "auth-string": "user:pass"
+    };
+    let clean = t.api.sanitize(def, ["auth-string"]);
+    assert.deepStrictEqual(clean, {
+        "name": "cache",
+        "password": "***",
+        "credentials": {"apiKey": "***", "client_secret": "***", "user": "admin"},
+        "connections": [{"auth-token": "***", "host": "db"}],
+        "Authorization": "***",
+        "auth-string": "***"
+    });
+    assert.strictEqual(def["password"], "hunter2");
+});
+
+test("a dry run prints bodies without their secrets", function () {
+    let t = setup();
+    let client = t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "sensitive": ["connection-string"]
+    });
+    let body = {"user": {"name": "app", "password": "hunter2", "settings": {"api_token": "tok-456"}},
+        "connection-string": "redis://app:hunter2@db"};
+    assert.throws(function () {
+        client.request({"dry-run": true}, "post", "/users", body);
+    }, /dry run/);
+    let log = t.rt.output.join("\n");
+    ["hunter2", "tok-456"].forEach(function (raw) {
+        assert.ok(!log.includes(raw), raw + " in " + log);
+    });
+    assert.ok(log.includes("\"name\":\"app\""));
+});
+
+test("failed requests throw errors with the status, provider code and path", function () {
+    let t = setup();
+    let client = t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function (body) {
+            return body.error.message;
+        },
+        "code": function (body) {
+            return body.error.code;
+        }
+    });
+    t.rt.handler = function () {
+        return {"statusCode": 404, "body": "{\"error\":{\"message\":\"No such thing\",\"code\":\"resource_missing\"}}"};
+    };
+    let error;
+    try {
+        client.request({}, "get", "/things/1");
+    } catch (e) {
+        error = e;
+    }
+    assert.strictEqual(error.message, "response code 404, No such thing");
+    assert.strictEqual(error.status, 404);
+    assert.strictEqual(error.provider, "Test");
+    assert.strictEqual(error.code, "resource_missing");
+    assert.strictEqual(error.path, "/things/1");
+    assert.ok(t.api.isNotFound(error));
+    assert.ok(t.api.isNotFound(new Error("response code 404, gone")));
+    assert.ok(!t.api.isNotFound(new Error("response code 4040")));
+});
+
+test("remove deletes a resource", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 204, "body": ""};
+    };
+    t.client.remove({"token": "abc"}, "/things/1");
+    assert.strictEqual(t.rt.requests[0].method, "DELETE");
+    assert.strictEqual(t.rt.requests[0].url, "https://api.test/things/1");
+    assert.deepStrictEqual(t.rt.output, []);
+});
+
+test("remove counts a missing resource as deleted unless told otherwise", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 404, "body": "{\"message\":\"not found\"}"};
+    };
+    t.client.remove({"token": "abc"}, "/things/1");
+    assert.deepStrictEqual(t.rt.output, ["Test /things/1 was already deleted"]);
+    assert.throws(function () {
+        t.client.remove({"token": "abc"}, "/things/1", {"missingOk": false});
+    }, /^Error: response code 404, not found$/);
+    t.rt.handler = function () {
+        return {"statusCode": 403, "body": "{\"message\":\"forbidden\"}"};
+    };
+    assert.throws(function () {
+        t.client.remove({"token": "abc"}, "/things/1");
+    }, /^Error: response code 403, forbidden$/);
+});
+
+test("credentials are validated once before the first change", function () {
+    let t = setup();
+    let client = t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function (def) {
+            return {"Authorization": "Bearer " + def["token"]};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "validate": {
+            "path": "/me",
+            "credentials": function (def) {
+                return "the token " + def["token"];
+            }
+        }
+    });
+    t.rt.handler = function (req) {
+        if (req.headers["Authorization"] === "Bearer bad") {
+            return {"statusCode": 401, "body": "{\"message\":\"invalid token\"}"};
+        }
+        return {"statusCode": 200, "body": "{}"};
+    };
+    client.request({"token": "good"}, "get", "/things");
+    client.request({"token": "good"}, "post", "/things", {});
+    client.request({"token": "good"}, "post", "/things", {});
+    assert.deepStrictEqual(t.rt.requests.map(function (r) {
+        return r.method + " " + r.url;
+    }), ["GET https://api.test/things", "GET https://api.test/me", "POST https://api.test/things", "POST https://api.test/things"]);
+
+    assert.throws(function () {
+        client.request({"token": "bad"}, "post", "/things", {});
+    }, /^Error: Test rejected the token bad \(response code 401, invalid token\), check that it is current/);
+    assert.strictEqual(t.rt.requests[t.rt.requests.length - 1].url, "https://api.test/me");
+});
+
+test("each operation has its own time budget", function () {
+    let t = setup();
+    let client = t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "retry": {"attempts": 10, "base-delay": 1, "max-delay": 1},
+        "timeouts": {"read": 5000, "delete": 120000}
+    });
+    t.rt.handler = function () {
+        return {"statusCode": 200, "body": "{}"};
+    };
+    client.request({}, "get", "/things");
+    client.request({}, "delete", "/things/1");
+    client.request({}, "put", "/things/1", {});
+    client.request({}, "get", "/slow", undefined, {"timeout": 600000});
+    assert.deepStrictEqual(t.rt.requests.map(function (r) {
+        return r.timeout;
+    }), [5, 120, 30, 600]);
+
+    // a budget too short for the backoff stops the retries
+    t.rt.handler = function () {
+        return {"statusCode": 503, "body": "", "headers": {"Retry-After": "1"}};
+    };
+    let start = t.rt.requests.length;
+    assert.throws(function () {
+        client.request({}, "get", "/things", undefined, {"timeout": 500});
+    }, /^Error: response code 503$/);
+    assert.strictEqual(t.rt.requests.length - start, 1);
+});
+
+let cachingClient = function (t) {
+    return t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "cacheReads": true
+    });
+};
+
+test("cached reads collapse duplicate GETs into one request", function () {
+    let t = setup();
+    let client = cachingClient(t);
+    let n = 0;
+    t.rt.handler = function () {
+        n++;
+        return {"statusCode": 200, "body": "{\"n\":" + n + "}"};
+    };
+    assert.deepStrictEqual(client.request({}, "get", "/things/1"), {"n": 1});
+    assert.deepStrictEqual(client.request({}, "get", "/things/1"), {"n": 1});
+    assert.deepStrictEqual(client.request({}, "get", "/things/1", undefined, {"cache": false}), {"n": 2});
+    assert.strictEqual(t.rt.requests.length, 2);
+
+    // without cacheReads every GET is sent
+    t.client.request({}, "get", "/things/1");
+    t.client.request({}, "get", "/things/1");
+    assert.strictEqual(t.rt.requests.length, 4);
+});
+
+test("a change drops the cached reads of related paths", function () {
+    let t = setup();
+    let client = cachingClient(t);
+    t.rt.handler = function () {
+        return {"statusCode": 200, "body": "{}"};
+    };
+    ["/things", "/things/1", "/things/1/parts", "/things/10", "/others"].forEach(function (path) {
+        client.request({}, "get", path);
+    });
+    client.request({}, "patch", "/things/1", {});
+    let start = t.rt.requests.length;
+    ["/things", "/things/1", "/things/1/parts", "/things/10", "/others"].forEach(function (path) {
+        client.request({}, "get", path);
+    });
+    assert.deepStrictEqual(t.rt.requests.slice(start).map(function (r) {
+        return r.url;
+    }), ["https://api.test/things", "https://api.test/things/1", "https://api.test/things/1/parts"]);
+});
+
+test("batch handles every item and collects the failures", function () {
+    let t = setup();
+    let result = t.api.batch([1, 2, 3, 4], function (n) {
+        if (n % 2 === 0) {
+            throw new Error("response code 500, item " + n);
+        }
+        return n * 10;
+    }, {
+        "name": function (n) {
+            return "item " + n;
+        }
+    });
+    assert.deepStrictEqual(result.succeeded, [{"item": 1, "result": 10}, {"item": 3, "result": 30}]);
+    assert.deepStrictEqual(result.failed.map(function (f) {
+        return f.item;
+    }), [2, 4]);
+    assert.deepStrictEqual(t.rt.output, ["item 2 failed: response code 500, item 2", "item 4 failed: response code 500, item 4"]);
+    let error = t.api.batchError(result, "items");
+    assert.strictEqual(error.message, "2 of 4 items failed: response code 500, item 2; response code 500, item 4");
+    assert.strictEqual(error.failed.length, 2);
+    assert.deepStrictEqual(t.api.failures(result, function (n) {
+        return "item-" + n;
+    }), {"item-2": "response code 500, item 2", "item-4": "response code 500, item 4"});
+});
+
+test("api-url sends the requests elsewhere", function () {
+    let t = setup();
+    t.client.request({"api-url": "http://localhost:8080/"}, "get", "/things?page=2");
+    t.client.request({"api-url": "https://api.gov.test"}, "get", "https://api.test/next");
+    assert.deepStrictEqual(t.rt.requests.map(function (r) {
+        return r.url;
+    }), ["http://localhost:8080/things?page=2", "https://api.gov.test/next"]);
+});
+
+test("verbosity picks what the client prints, with bodies sanitized", function () {
+    let t = setup();
+    t.rt.handler = function (req) {
+        return {"statusCode": 200, "body": req.method === "POST" ? "{\"id\":\"1\",\"api_key\":\"k-123\"}" : ""};
+    };
+    let run = function (verbosity) {
+        t.rt.output.length = 0;
+        t.client.request({"token": "t", "verbosity": verbosity}, "post", "/things", {"name": "a", "password": "p"});
+        t.client.remove({"token": "t", "verbosity": verbosity}, "/things/1");
+        return t.rt.output.map(function (line) {
+            return line.replace(/\(\d+ms\)/, "(Nms)");
+        });
+    };
+    assert.deepStrictEqual(run("silent"), []);
+    assert.deepStrictEqual(run("info"), []);
+    assert.deepStrictEqual(run("debug"), [
+        "POST https://api.test/things 200 (Nms)",
+        "DELETE https://api.test/things/1 200 (Nms)"
+    ]);
+    assert.deepStrictEqual(run("trace"), [
+        "POST https://api.test/things\n{\"name\":\"a\",\"password\":\"***\"}",
+        "POST https://api.test/things 200 (Nms)",
+        "{\"id\":\"1\",\"api_key\":\"***\"}",
+        "DELETE https://api.test/things/1 200 (Nms)",
+        "(empty body)"
+    ]);
+    assert.throws(function () {
+        t.client.request({"verbosity": "loud"}, "get", "/things");
+    }, /verbosity must be one of silent, info, debug, trace, got loud/);
+});
+
+// RFC 2617, section 3.5
+test("digest response of the RFC example", function () {
+    let api = testing.runtime().require("common/api");
+    assert.strictEqual(api.digestResponse({
+        "username": "Mufasa",
+        "password": "Circle Of Life",
+        "realm": "testrealm@host.com",
+        "nonce": "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+        "method": "GET",
+        "uri": "/dir/index.html",
+        "qop": "auth",
+        "nc": "00000001",
+        "cnonce": "0a4f113b"
+    }), "6629fae49393a05397450978507c4ef1");
+});
+
+// digestServer plays a server with digest authentication: it challenges
+// requests without a valid answer to its current nonce and checks answers
+// with node's own MD5
+let digestServer = function (username, password) {
+    const nodeCrypto = require("crypto");
+    let md5 = function (s) {
+        return nodeCrypto.createHash("md5").update(s).digest("hex");
+    };
+    let server = {"nonce": "n-1", "challenges": 0, "ncs": []};
+    server.handler = function (req) {
+        let auth = {};
+        let value = req.headers["Authorization"] || "";
+        value.replace(/(\w+)=(?:"([^"]*)"|([^\s,]*))/g, function (m, k, quoted, plain) {
+            auth[k] = quoted !== undefined ? quoted : plain;
+        });
+        let expected = md5([md5(username + ":api@test:" + password), server.nonce, auth.nc, auth.cnonce, "auth",
+            md5(req.method + ":" + req.url.replace("https://api.test", ""))].join(":"));
+        if (value.indexOf("Digest ") !== 0 || auth.nonce !== server.nonce || auth.response !== expected ||
+            auth.opaque !== "o-1") {
+            server.challenges++;
+            return {
+                "statusCode": 401,
+                "body": "{\"message\": \"unauthorized\"}",
+                "headers": {"WWW-Authenticate": ["Digest realm=\"api@test\", domain=\"\", nonce=\"" + server.nonce +
+                    "\", qop=\"auth\", opaque=\"o-1\", algorithm=MD5, stale=FALSE"]}
+            };
+        }
+        server.ncs.push(auth.nc);
+        return {"statusCode": 200, "body": "{\"ok\": true}"};
+    };
+    return server;
+};
+
+let digestClient = function (t) {
+    return t.api.client({
+        "name": "Test",
+        "baseUrl": "https://api.test",
+        "headers": function () {
+            return {};
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "digest": function (def) {
+            return def["public-key"] ? {"username": def["public-key"], "password": def["private-key"]} : null;
+        }
+    });
+};
+
+test("digest challenges are answered and their nonce reused", function () {
+    let t = setup();
+    let server = digestServer("pub", "priv");
+    t.rt.handler = server.handler;
+    let client = digestClient(t);
+    let def = {"public-key": "pub", "private-key": "priv"};
+    assert.deepStrictEqual(client.request(def, "post", "/things", {"name": "a"}), {"ok": true});
+    assert.deepStrictEqual(client.request(def, "get", "/things?page=2"), {"ok": true});
+    assert.strictEqual(server.challenges, 1);
+    assert.strictEqual(t.rt.requests.length, 3);
+    assert.deepStrictEqual(server.ncs, ["00000001", "00000002"]);
+
+    // a new nonce is answered once
+    server.nonce = "n-2";
+    assert.deepStrictEqual(client.request(def, "get", "/things"), {"ok": true});
+    assert.strictEqual(server.challenges, 2);
+    assert.deepStrictEqual(server.ncs, ["00000001", "00000002", "00000001"]);
+});
+
+test("wrong digest credentials fail without looping", function () {
+    let t = setup();
+    let server = digestServer("pub", "priv");
+    t.rt.handler = server.handler;
+    let client = digestClient(t);
+    assert.throws(function () {
+        client.request({"public-key": "pub", "private-key": "wrong"}, "get", "/things");
+    }, /^Error: response code 401, unauthorized$/);
+    assert.strictEqual(t.rt.requests.length, 2);
+});
+
+test("definitions without digest credentials send the headers alone", function () {
+    let t = setup();
+    let client = digestClient(t);
+    client.request({}, "get", "/things");
+    assert.strictEqual(t.rt.requests.length, 1);
+    assert.strictEqual(t.rt.requests[0].headers["Authorization"], undefined);
+});
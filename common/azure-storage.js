@@ -0,0 +1,152 @@
+// Azure Storage data plane access for the Azure entities that manage blobs,
+// queues, tables or files in a storage account, rather than the account
+// itself through Resource Manager. A definition names the account in
+// accountName and authenticates with an account key in the Monk secret named
+// in accessKeySecret, as objectstorage/storage-account stores it, or with a
+// SAS token in the Monk secret named in sasTokenSecret:
+//
+//     let blob = storage.client({"name": "Azure Blob Storage", "service": "blob"});
+//     blob.send(def, "put", "/" + def.containerName + "?restype=container");
+let parser = require("parser");
+let secret = require("secret");
+let api = require("common/api");
+let crypto = require("common/crypto");
+
+// VERSION is the Storage service version requests ask for
+const VERSION = "2021-08-06";
+
+// STANDARD_HEADERS are the headers whose values a Shared Key signature
+// covers, in the order of the string to sign
+const STANDARD_HEADERS = [
+    "Content-Encoding", "Content-Language", "Content-Length", "Content-MD5", "Content-Type", "Date",
+    "If-Modified-Since", "If-Match", "If-None-Match", "If-Unmodified-Since", "Range"
+];
+
+let headerValue = function (headers, name) {
+    for (let key in headers) {
+        if (key.toLowerCase() === name.toLowerCase()) {
+            return String(headers[key]);
+        }
+    }
+    return "";
+};
+
+let decode = function (s) {
+    try {
+        return decodeURIComponent(s.replace(/\+/g, "%20"));
+    } catch (e) {
+        return s;
+    }
+};
+
+// canonicalResource returns the account, the path and the query parameters
+// of a URL as Shared Key signs them: parameter names in lower case and sorted,
+// the values of a repeated parameter sorted and joined by commas
+let canonicalResource = function (account, path, query) {
+    let params = {};
+    (query || "").split("&").filter(Boolean).forEach(function (param) {
+        let i = param.indexOf("=");
+        let name = decode(i < 0 ? param : param.substring(0, i)).toLowerCase();
+        (params[name] = params[name] || []).push(decode(i < 0 ? "" : param.substring(i + 1)));
+    });
+    return "/" + account + (path || "/") + Object.keys(params).sort().map(function (name) {
+        return "\n" + name + ":" + params[name].sort().join(",");
+    }).join("");
+};
+
+// sharedKey returns the headers that authenticate a request with the Shared
+// Key scheme of the Blob, Queue and File services: the request's own headers
+// plus x-ms-date and Authorization. All headers passed in are signed, so the
+// request must send them as given. opts holds:
+//
+//   account  the storage account name
+//   key      the base64 account key
+//   date     optional time of the request, now by default
+let sharedKey = function (method, url, headers, body, opts) {
+    let match = /^https?:\/\/[^\/?#]+([^?#]*)(?:\?([^#]*))?/.exec(url);
+    if (!match) {
+        throw new Error("can't sign a request to " + url);
+    }
+    let out = Object.assign({}, headers);
+    out["x-ms-date"] = (opts["date"] || new Date()).toUTCString();
+
+    let length = body ? crypto.utf8Bytes(body).length : 0;
+    let standard = STANDARD_HEADERS.map(function (name) {
+        if (name === "Content-Length") {
+            return length > 0 ? String(length) : "";
+        }
+        return headerValue(out, name);
+    });
+    let msHeaders = {};
+    for (let name in out) {
+        if (name.toLowerCase().indexOf("x-ms-") === 0) {
+            msHeaders[name.toLowerCase()] = String(out[name]).trim().replace(/\s+/g, " ");
+        }
+    }
+    let canonicalHeaders = Object.keys(msHeaders).sort().map(function (name) {
+        return name + ":" + msHeaders[name] + "\n";
+    }).join("");
+    let stringToSign = [method.toUpperCase()].concat(standard).join("\n") + "\n" + canonicalHeaders +
+        canonicalResource(opts["account"], match[1], match[2]);
+
+    let signature = crypto.toBase64(crypto.hmacSha256(crypto.fromBase64(opts["key"]), stringToSign));
+    out["Authorization"] = "SharedKey " + opts["account"] + ":" + signature;
+    return out;
+};
+
+// client returns an API client of a storage service of the definition's
+// account. config holds the client's name and the service, "blob", "queue"
+// or "file". Error bodies are XML.
+let client = function (config) {
+    let usesKey = function (def) {
+        if (def.accessKeySecret) {
+            return true;
+        }
+        if (def.sasTokenSecret) {
+            return false;
+        }
+        throw new Error("set accessKeySecret for an account key or sasTokenSecret for a SAS token");
+    };
+
+    return api.client({
+        "name": config.name,
+        "baseUrl": function (def) {
+            return "https://" + def.accountName + "." + config.service + ".core.windows.net";
+        },
+        "headers": function () {
+            return {"x-ms-version": VERSION};
+        },
+        "encode": function (body) {
+            return body;
+        },
+        "contentType": "application/xml",
+        "parseError": function (body) {
+            return {
+                "message": parser.xmlquery(body, "//Error/Message")[0],
+                "code": parser.xmlquery(body, "//Error/Code")[0]
+            };
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "code": function (body) {
+            return body.code;
+        },
+        "sign": function (def, method, url, headers, body) {
+            if (!usesKey(def)) {
+                return headers;
+            }
+            return sharedKey(method, url, headers, body, {
+                "account": def.accountName,
+                "key": secret.get(def.accessKeySecret)
+            });
+        },
+        "authQuery": function (def) {
+            return usesKey(def) ? "" : secret.get(def.sasTokenSecret).replace(/^\?/, "");
+        }
+    });
+};
+
+exports.VERSION = VERSION;
+exports.sharedKey = sharedKey;
+exports.client = client;
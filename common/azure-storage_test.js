@@ -0,0 +1,84 @@
+// Tests for common/azure-storage: node common/azure-storage_test.js
+const crypto = require("crypto");
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+const KEY = Buffer.from("account-key-bytes").toString("base64");
+
+let expected = function (stringToSign) {
+    return crypto.createHmac("sha256", Buffer.from(KEY, "base64")).update(stringToSign, "utf8").digest("base64");
+};
+
+let setup = function () {
+    let rt = testing.runtime();
+    rt.secrets["account-key"] = KEY;
+    rt.secrets["account-sas"] = "?sv=2022-11-02&sig=abc%2Bdef";
+    let storage = rt.require("common/azure-storage");
+    return {"rt": rt, "storage": storage, "client": storage.client({"name": "Test", "service": "blob"})};
+};
+
+test("Shared Key signs the standard headers, x-ms headers and canonical resource", function () {
+    let storage = setup().storage;
+    let headers = storage.sharedKey("PUT", "https://acct.blob.core.windows.net/my%20container?restype=container&comp=metadata", {
+        "x-ms-version": "2021-08-06",
+        "x-ms-meta-Owner": "  platform  team ",
+        "x-ms-meta-a": "1",
+        "Content-Type": "application/xml"
+    }, "<a>é</a>", {"account": "acct", "key": KEY, "date": new Date("2024-01-02T03:04:05Z")});
+    assert.strictEqual(headers["x-ms-date"], "Tue, 02 Jan 2024 03:04:05 GMT");
+    let stringToSign = "PUT\n\n\n9\n\napplication/xml\n\n\n\n\n\n\n" +
+        "x-ms-date:Tue, 02 Jan 2024 03:04:05 GMT\nx-ms-meta-a:1\nx-ms-meta-owner:platform team\nx-ms-version:2021-08-06\n" +
+        "/acct/my%20container\ncomp:metadata\nrestype:container";
+    assert.strictEqual(headers["Authorization"], "SharedKey acct:" + expected(stringToSign));
+});
+
+test("an empty body signs an empty Content-Length", function () {
+    let storage = setup().storage;
+    let headers = storage.sharedKey("DELETE", "https://acct.blob.core.windows.net/c?restype=container", {},
+        undefined, {"account": "acct", "key": KEY, "date": new Date("2024-01-02T03:04:05Z")});
+    assert.strictEqual(headers["Authorization"], "SharedKey acct:" +
+        expected("DELETE\n\n\n\n\n\n\n\n\n\n\n\nx-ms-date:Tue, 02 Jan 2024 03:04:05 GMT\n/acct/c\nrestype:container"));
+});
+
+test("requests with an account key carry the version and a signature", function () {
+    let t = setup();
+    t.client.send({"accountName": "acct", "accessKeySecret": "account-key"}, "put", "/c?restype=container");
+    let req = t.rt.requests[0];
+    assert.strictEqual(req.url, "https://acct.blob.core.windows.net/c?restype=container");
+    assert.strictEqual(req.headers["x-ms-version"], "2021-08-06");
+    assert.match(req.headers["Authorization"], /^SharedKey acct:[A-Za-z0-9+\/]+=*$/);
+});
+
+test("requests with a SAS token carry it in the query only", function () {
+    let t = setup();
+    let def = {"accountName": "acct", "sasTokenSecret": "account-sas", "verbosity": "debug"};
+    t.client.send(def, "delete", "/c?restype=container");
+    let req = t.rt.requests[0];
+    assert.strictEqual(req.url, "https://acct.blob.core.windows.net/c?restype=container&sv=2022-11-02&sig=abc%2Bdef");
+    assert.strictEqual(req.headers["Authorization"], undefined);
+    assert.strictEqual(t.rt.output.length, 1);
+    assert.ok(t.rt.output.every(function (line) {
+        return !line.includes("sig=");
+    }), "the SAS token is printed: " + t.rt.output);
+});
+
+test("XML errors give the message and code", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 409, "body": "<?xml version=\"1.0\"?><Error><Code>ContainerAlreadyExists</Code>" +
+            "<Message>The specified container already exists.</Message></Error>"};
+    };
+    assert.throws(function () {
+        t.client.send({"accountName": "acct", "accessKeySecret": "account-key"}, "put", "/c?restype=container");
+    }, function (e) {
+        return e.code === "ContainerAlreadyExists" && /response code 409, The specified container already exists\./.test(e.message);
+    });
+});
+
+test("a definition without credentials is refused", function () {
+    let t = setup();
+    assert.throws(function () {
+        t.client.send({"accountName": "acct"}, "get", "/c?restype=container");
+    }, /set accessKeySecret for an account key or sasTokenSecret for a SAS token/);
+});
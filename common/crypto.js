@@ -0,0 +1,363 @@
+// Hashes and byte helpers shared by the entities, in plain JavaScript as the
+// entity runtime has no crypto primitives of its own. Byte strings are arrays
+// of numbers.
+let secret = require("secret");
+
+// utf8Bytes returns the UTF-8 encoding of a string
+let utf8Bytes = function (s) {
+    let encoded = encodeURIComponent(s);
+    let out = [];
+    for (let i = 0; i < encoded.length; i++) {
+        if (encoded[i] === "%") {
+            out.push(parseInt(encoded.substr(i + 1, 2), 16));
+            i += 2;
+        } else {
+            out.push(encoded.charCodeAt(i));
+        }
+    }
+    return out;
+};
+
+// bytesOf accepts a string or a byte array, so callers can pass either
+let bytesOf = function (input) {
+    return typeof input === "string" ? utf8Bytes(input) : input;
+};
+
+let toHex = function (bytes) {
+    let out = "";
+    for (let i = 0; i < bytes.length; i++) {
+        out += (bytes[i] < 16 ? "0" : "") + bytes[i].toString(16);
+    }
+    return out;
+};
+
+let fromHex = function (s) {
+    let out = [];
+    for (let i = 0; i < s.length; i += 2) {
+        out.push(parseInt(s.substr(i, 2), 16));
+    }
+    return out;
+};
+
+const BASE64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+
+// fromBase64 decodes standard and URL-safe base64, with or without padding
+let fromBase64 = function (s) {
+    let out = [];
+    let bits = 0, value = 0;
+    for (let i = 0; i < s.length && s[i] !== "="; i++) {
+        let ch = s[i] === "-" ? "+" : s[i] === "_" ? "/" : s[i];
+        let c = BASE64.indexOf(ch);
+        if (c < 0) {
+            throw new Error("invalid base64 character " + JSON.stringify(s[i]));
+        }
+        value = ((value << 6) | c) & 0xffffff;
+        bits += 6;
+        if (bits >= 8) {
+            bits -= 8;
+            out.push((value >>> bits) & 0xff);
+        }
+    }
+    return out;
+};
+
+let toBase64 = function (bytes) {
+    let binary = "";
+    for (let i = 0; i < bytes.length; i++) {
+        binary += String.fromCharCode(bytes[i]);
+    }
+    return btoa(binary);
+};
+
+let zeros = function (n) {
+    let out = [];
+    for (let i = 0; i < n; i++) {
+        out.push(0);
+    }
+    return out;
+};
+
+// --- BLAKE2b, with 64-bit words held as pairs of 32-bit halves (low, high)
+
+const BLAKE2B_IV = [
+    0xf3bcc908, 0x6a09e667, 0x84caa73b, 0xbb67ae85, 0xfe94f82b, 0x3c6ef372, 0x5f1d36f1, 0xa54ff53a,
+    0xade682d1, 0x510e527f, 0x2b3e6c1f, 0x9b05688c, 0xfb41bd6b, 0x1f83d9ab, 0x137e2179, 0x5be0cd19
+];
+
+const BLAKE2B_SIGMA = [
+    [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15],
+    [14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3],
+    [11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4],
+    [7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8],
+    [9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13],
+    [2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9],
+    [12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11],
+    [13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10],
+    [6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5],
+    [10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0]
+];
+
+// add64 adds the 64-bit word (lo, hi) to word a of v
+let add64 = function (v, a, lo, hi) {
+    let sum = v[a] + lo;
+    v[a + 1] = (v[a + 1] + hi + (sum >= 0x100000000 ? 1 : 0)) >>> 0;
+    v[a] = sum >>> 0;
+};
+
+// rotr64 sets word a of v to (word a ^ word b) rotated right by n bits
+let rotr64 = function (v, a, b, n) {
+    let lo = (v[a] ^ v[b]) >>> 0, hi = (v[a + 1] ^ v[b + 1]) >>> 0;
+    if (n >= 32) {
+        let t = lo;
+        lo = hi;
+        hi = t;
+        n -= 32;
+    }
+    if (n > 0) {
+        let t = lo;
+        lo = ((lo >>> n) | (hi << (32 - n))) >>> 0;
+        hi = ((hi >>> n) | (t << (32 - n))) >>> 0;
+    }
+    v[a] = lo;
+    v[a + 1] = hi;
+};
+
+let blake2bMix = function (v, m, a, b, c, d, x, y) {
+    add64(v, a, v[b], v[b + 1]);
+    add64(v, a, m[x], m[x + 1]);
+    rotr64(v, d, a, 32);
+    add64(v, c, v[d], v[d + 1]);
+    rotr64(v, b, c, 24);
+    add64(v, a, v[b], v[b + 1]);
+    add64(v, a, m[y], m[y + 1]);
+    rotr64(v, d, a, 16);
+    add64(v, c, v[d], v[d + 1]);
+    rotr64(v, b, c, 63);
+};
+
+let blake2bCompress = function (h, block, length, last) {
+    let m = [];
+    for (let i = 0; i < 32; i++) {
+        m.push((block[i * 4] | (block[i * 4 + 1] << 8) | (block[i * 4 + 2] << 16) | (block[i * 4 + 3] << 24)) >>> 0);
+    }
+    let v = h.concat(BLAKE2B_IV);
+    // messages here are far below 4 GiB, so the high words of the counter stay zero
+    v[24] = (v[24] ^ length) >>> 0;
+    if (last) {
+        v[28] = ~v[28] >>> 0;
+        v[29] = ~v[29] >>> 0;
+    }
+    for (let round = 0; round < 12; round++) {
+        let s = BLAKE2B_SIGMA[round % 10];
+        blake2bMix(v, m, 0, 8, 16, 24, s[0] * 2, s[1] * 2);
+        blake2bMix(v, m, 2, 10, 18, 26, s[2] * 2, s[3] * 2);
+        blake2bMix(v, m, 4, 12, 20, 28, s[4] * 2, s[5] * 2);
+        blake2bMix(v, m, 6, 14, 22, 30, s[6] * 2, s[7] * 2);
+        blake2bMix(v, m, 0, 10, 20, 30, s[8] * 2, s[9] * 2);
+        blake2bMix(v, m, 2, 12, 22, 24, s[10] * 2, s[11] * 2);
+        blake2bMix(v, m, 4, 14, 16, 26, s[12] * 2, s[13] * 2);
+        blake2bMix(v, m, 6, 8, 18, 28, s[14] * 2, s[15] * 2);
+    }
+    for (let i = 0; i < 16; i++) {
+        h[i] = (h[i] ^ v[i] ^ v[i + 16]) >>> 0;
+    }
+};
+
+// blake2b returns the BLAKE2b hash of input, size bytes long, keyed with key
+// if one is given (RFC 7693)
+let blake2b = function (input, size, key) {
+    input = bytesOf(input);
+    key = key ? bytesOf(key) : [];
+    let h = BLAKE2B_IV.slice();
+    h[0] = (h[0] ^ 0x01010000 ^ (key.length << 8) ^ size) >>> 0;
+    if (key.length > 0) {
+        // a key is hashed as a first block of its own
+        input = key.concat(zeros(128 - key.length), input);
+    }
+    let offset = 0;
+    do {
+        let block = input.slice(offset, offset + 128);
+        offset += block.length;
+        let last = offset >= input.length;
+        blake2bCompress(h, block.concat(zeros(128 - block.length)), offset, last);
+    } while (offset < input.length);
+
+    let out = [];
+    for (let i = 0; i < size; i++) {
+        out.push((h[i >> 2] >>> (8 * (i & 3))) & 0xff);
+    }
+    return out;
+};
+
+// --- SHA-256 and HMAC-SHA256
+
+const SHA256_K = [
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+];
+
+let rotr32 = function (x, n) {
+    return (x >>> n) | (x << (32 - n));
+};
+
+// sha256 returns the SHA-256 hash of a string or byte array
+let sha256 = function (input) {
+    let bytes = bytesOf(input).slice();
+    let bitLength = bytes.length * 8;
+    bytes.push(0x80);
+    while (bytes.length % 64 !== 56) {
+        bytes.push(0);
+    }
+    bytes.push(0, 0, 0, Math.floor(bitLength / 0x100000000) & 0xff);
+    bytes.push((bitLength >>> 24) & 0xff, (bitLength >>> 16) & 0xff, (bitLength >>> 8) & 0xff, bitLength & 0xff);
+
+    let h = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+    let w = [];
+    for (let offset = 0; offset < bytes.length; offset += 64) {
+        for (let i = 0; i < 16; i++) {
+            let j = offset + i * 4;
+            w[i] = (bytes[j] << 24) | (bytes[j + 1] << 16) | (bytes[j + 2] << 8) | bytes[j + 3];
+        }
+        for (let i = 16; i < 64; i++) {
+            let s0 = rotr32(w[i - 15], 7) ^ rotr32(w[i - 15], 18) ^ (w[i - 15] >>> 3);
+            let s1 = rotr32(w[i - 2], 17) ^ rotr32(w[i - 2], 19) ^ (w[i - 2] >>> 10);
+            w[i] = (w[i - 16] + s0 + w[i - 7] + s1) | 0;
+        }
+        let a = h[0], b = h[1], c = h[2], d = h[3], e = h[4], f = h[5], g = h[6], k = h[7];
+        for (let i = 0; i < 64; i++) {
+            let t1 = (k + (rotr32(e, 6) ^ rotr32(e, 11) ^ rotr32(e, 25)) + ((e & f) ^ (~e & g)) + SHA256_K[i] + w[i]) | 0;
+            let t2 = ((rotr32(a, 2) ^ rotr32(a, 13) ^ rotr32(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+            k = g;
+            g = f;
+            f = e;
+            e = (d + t1) | 0;
+            d = c;
+            c = b;
+            b = a;
+            a = (t1 + t2) | 0;
+        }
+        h = [a, b, c, d, e, f, g, k].map(function (v, i) {
+            return (h[i] + v) | 0;
+        });
+    }
+
+    let out = [];
+    h.forEach(function (v) {
+        out.push((v >>> 24) & 0xff, (v >>> 16) & 0xff, (v >>> 8) & 0xff, v & 0xff);
+    });
+    return out;
+};
+
+// MD5_S are the per-round shift amounts of MD5, MD5_K its sine constants
+const MD5_S = [7, 12, 17, 22, 5, 9, 14, 20, 4, 11, 16, 23, 6, 10, 15, 21];
+const MD5_K = [];
+for (let i = 0; i < 64; i++) {
+    MD5_K[i] = Math.floor(Math.abs(Math.sin(i + 1)) * 0x100000000) | 0;
+}
+
+// md5 returns the MD5 (RFC 1321) of a string or byte array. MD5 is broken for
+// signatures; it is here for HTTP digest authentication, which still uses it.
+let md5 = function (input) {
+    let bytes = bytesOf(input).slice();
+    let bitLength = bytes.length * 8;
+    bytes.push(0x80);
+    while (bytes.length % 64 !== 56) {
+        bytes.push(0);
+    }
+    bytes.push(bitLength & 0xff, (bitLength >>> 8) & 0xff, (bitLength >>> 16) & 0xff, (bitLength >>> 24) & 0xff);
+    bytes.push(Math.floor(bitLength / 0x100000000) & 0xff, 0, 0, 0);
+
+    let h = [0x67452301, 0xefcdab89 | 0, 0x98badcfe | 0, 0x10325476];
+    for (let offset = 0; offset < bytes.length; offset += 64) {
+        let m = [];
+        for (let i = 0; i < 16; i++) {
+            let j = offset + i * 4;
+            m[i] = bytes[j] | (bytes[j + 1] << 8) | (bytes[j + 2] << 16) | (bytes[j + 3] << 24);
+        }
+        let a = h[0], b = h[1], c = h[2], d = h[3];
+        for (let i = 0; i < 64; i++) {
+            let f, g;
+            if (i < 16) {
+                f = (b & c) | (~b & d);
+                g = i;
+            } else if (i < 32) {
+                f = (d & b) | (~d & c);
+                g = (5 * i + 1) % 16;
+            } else if (i < 48) {
+                f = b ^ c ^ d;
+                g = (3 * i + 5) % 16;
+            } else {
+                f = c ^ (b | ~d);
+                g = (7 * i) % 16;
+            }
+            let t = d;
+            d = c;
+            c = b;
+            let x = (a + f + MD5_K[i] + m[g]) | 0;
+            let shift = MD5_S[(i >> 4) * 4 + (i % 4)];
+            b = (b + ((x << shift) | (x >>> (32 - shift)))) | 0;
+            a = t;
+        }
+        h = [a, b, c, d].map(function (v, i) {
+            return (h[i] + v) | 0;
+        });
+    }
+
+    let out = [];
+    h.forEach(function (v) {
+        out.push(v & 0xff, (v >>> 8) & 0xff, (v >>> 16) & 0xff, (v >>> 24) & 0xff);
+    });
+    return out;
+};
+
+// hmacSha256 returns the HMAC-SHA256 (RFC 2104) of message under key, both
+// strings or byte arrays
+let hmacSha256 = function (key, message) {
+    key = bytesOf(key);
+    if (key.length > 64) {
+        key = sha256(key);
+    }
+    key = key.concat(zeros(64 - key.length));
+    let inner = key.map(function (b) {
+        return b ^ 0x36;
+    });
+    let outer = key.map(function (b) {
+        return b ^ 0x5c;
+    });
+    return sha256(outer.concat(sha256(inner.concat(bytesOf(message)))));
+};
+
+// valueHash returns a hex HMAC-SHA256 of a secret value under key, so state
+// can tell whether the value changed without holding it. Entities key it with
+// their API token: without the key the hash can't be checked against guesses
+// of the value.
+let valueHash = function (key, value) {
+    return toHex(hmacSha256(key, value));
+};
+
+// randomBytes returns n random bytes, n at most 64. The runtime offers no
+// random bytes, only secret.randString, the generator the entities already
+// use for the passwords they create. 64 of its alphanumeric characters carry
+// about 381 bits, which BLAKE2b condenses into uniformly distributed bytes.
+let randomBytes = function (n) {
+    return blake2b(secret.randString(64), n);
+};
+
+exports.utf8Bytes = utf8Bytes;
+exports.toHex = toHex;
+exports.fromHex = fromHex;
+exports.fromBase64 = fromBase64;
+exports.toBase64 = toBase64;
+exports.zeros = zeros;
+exports.blake2b = blake2b;
+exports.sha256 = sha256;
+exports.md5 = md5;
+exports.hmacSha256 = hmacSha256;
+exports.valueHash = valueHash;
+exports.randomBytes = randomBytes;
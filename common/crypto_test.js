@@ -0,0 +1,108 @@
+// Known-answer tests for common/crypto: node common/crypto_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+const rt = testing.runtime();
+const crypto = rt.require("common/crypto");
+
+let range = function (n) {
+    let out = [];
+    for (let i = 0; i < n; i++) {
+        out.push(i % 256);
+    }
+    return out;
+};
+
+test("utf8Bytes encodes multi-byte characters", function () {
+    assert.deepStrictEqual(crypto.utf8Bytes("aé€😀"), [0x61, 0xc3, 0xa9, 0xe2, 0x82, 0xac, 0xf0, 0x9f, 0x98, 0x80]);
+});
+
+test("base64 round trips, URL-safe and unpadded input decodes", function () {
+    let bytes = range(256);
+    assert.deepStrictEqual(crypto.fromBase64(crypto.toBase64(bytes)), bytes);
+    assert.deepStrictEqual(crypto.fromBase64("-_8"), [0xfb, 0xff]);
+    assert.strictEqual(crypto.toBase64(crypto.utf8Bytes("foob")), "Zm9vYg==");
+});
+
+test("hex round trips", function () {
+    assert.strictEqual(crypto.toHex([0, 15, 16, 255]), "000f10ff");
+    assert.deepStrictEqual(crypto.fromHex("000f10ff"), [0, 15, 16, 255]);
+});
+
+// RFC 7693, appendix A
+test("BLAKE2b-512 of abc", function () {
+    assert.strictEqual(crypto.toHex(crypto.blake2b("abc", 64)),
+        "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d1" +
+        "7d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923");
+});
+
+test("BLAKE2b-512 of the empty string", function () {
+    assert.strictEqual(crypto.toHex(crypto.blake2b([], 64)),
+        "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419" +
+        "d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce");
+});
+
+test("BLAKE2b-256 of exactly one block", function () {
+    assert.strictEqual(crypto.toHex(crypto.blake2b(range(128), 32)),
+        "c3582f71ebb2be66fa5dd750f80baae97554f3b015663c8be377cfcb2488c1d1");
+});
+
+// blake2b-kat.txt from the BLAKE2 reference implementation, key 00..3f
+test("keyed BLAKE2b-512", function () {
+    assert.strictEqual(crypto.toHex(crypto.blake2b([], 64, range(64))),
+        "10ebb67700b1868efb4417987acf4690ae9d972fb7a590c2f02871799aaa4786" +
+        "b5e996e8f0f4eb981fc214b005f42d2ff4233499391653df7aefcbc13fc51568");
+    assert.strictEqual(crypto.toHex(crypto.blake2b(range(255), 64, range(64))),
+        "142709d62e28fcccd0af97fad0f8465b971e82201dc51070faa0372aa43e9248" +
+        "4be1c1e73ba10906d5d1853db6a4106e0a7bf9800d373d6dee2d46d62ef2a461");
+});
+
+// FIPS 180-2 examples
+test("SHA-256", function () {
+    assert.strictEqual(crypto.toHex(crypto.sha256("")),
+        "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855");
+    assert.strictEqual(crypto.toHex(crypto.sha256("abc")),
+        "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad");
+    assert.strictEqual(crypto.toHex(crypto.sha256("abcdbcdecdefdefgefghfghighijhijkijkljklmklmnlmnomnopnopq")),
+        "248d6a61d20638b8e5c026930c3e6039a33ce45964ff2167f6ecedd419db06c1");
+    assert.strictEqual(crypto.toHex(crypto.sha256("a".repeat(1000))),
+        "41edece42d63e8d9bf515a9ba6932e1c20cbc9f5a5d134645adb5db1b9737ea3");
+});
+
+// RFC 1321 test suite, and a message of several blocks
+test("MD5", function () {
+    assert.strictEqual(crypto.toHex(crypto.md5("")), "d41d8cd98f00b204e9800998ecf8427e");
+    assert.strictEqual(crypto.toHex(crypto.md5("abc")), "900150983cd24fb0d6963f7d28e17f72");
+    assert.strictEqual(crypto.toHex(crypto.md5("message digest")), "f96b697d7cb7938d525a2f31aaf161d0");
+    assert.strictEqual(crypto.toHex(crypto.md5("a".repeat(1000))), "cabe45dcc9ae5b66ba86600cca6b8ba8");
+});
+
+// RFC 4231, test cases 1, 2 and 6
+test("HMAC-SHA256", function () {
+    let repeat = function (b, n) {
+        return crypto.zeros(n).map(function () {
+            return b;
+        });
+    };
+    assert.strictEqual(crypto.toHex(crypto.hmacSha256(repeat(0x0b, 20), "Hi There")),
+        "b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7");
+    assert.strictEqual(crypto.toHex(crypto.hmacSha256("Jefe", "what do ya want for nothing?")),
+        "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843");
+    assert.strictEqual(crypto.toHex(crypto.hmacSha256(repeat(0xaa, 131),
+        "Test Using Larger Than Block-Size Key - Hash Key First")),
+        "60e431591ee0b67f0d8a26aacbf5b77f8e0bc6213728c5140546040f0ee37f54");
+});
+
+test("valueHash depends on the key", function () {
+    assert.strictEqual(crypto.valueHash("token", "value"),
+        "cf5c685b525c32a11a1398b58f749faa131d7870986d221700a645a0ae7b4e77");
+    assert.notStrictEqual(crypto.valueHash("other-token", "value"), crypto.valueHash("token", "value"));
+});
+
+test("randomBytes draws a fresh value each call", function () {
+    let a = crypto.randomBytes(32);
+    let b = crypto.randomBytes(32);
+    assert.strictEqual(a.length, 32);
+    assert.notDeepStrictEqual(a, b);
+});
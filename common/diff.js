@@ -0,0 +1,60 @@
+// Diffs between the current state of a provider resource and the desired
+// one, so that updates send only what changed.
+
+// same compares two values by content, with null and undefined alike
+let same = function (a, b) {
+    if ((a === undefined || a === null) && (b === undefined || b === null)) {
+        return true;
+    }
+    return JSON.stringify(a) === JSON.stringify(b);
+};
+
+let isObject = function (value) {
+    return value !== null && typeof value === "object" && !Array.isArray(value);
+};
+
+// computeDiff returns the fields of desired that differ from current, for a
+// PATCH-style update; an empty object when nothing changed. Fields current
+// has but desired doesn't, such as ones the provider fills in, are not
+// compared. Nested objects are diffed field by field and arrays compared as
+// a whole. opts may hold:
+//
+//   ignore    fields never sent, e.g. a type tag the update adds itself
+//   whole     nested objects sent in full when any of their fields changed,
+//             e.g. references that need both an ID and a type
+//   together  groups of fields sent together when any of them changed
+let computeDiff = function (current, desired, opts) {
+    opts = opts || {};
+    current = current || {};
+    let diff = {};
+    for (let key in desired) {
+        if ((opts.ignore || []).includes(key)) {
+            continue;
+        }
+        let want = desired[key];
+        let have = current[key];
+        if (isObject(want) && isObject(have)) {
+            let nested = computeDiff(have, want);
+            if (Object.keys(nested).length > 0) {
+                diff[key] = (opts.whole || []).includes(key) ? want : nested;
+            }
+        } else if (!same(have, want)) {
+            diff[key] = want;
+        }
+    }
+    (opts.together || []).forEach(function (group) {
+        let touched = group.some(function (key) {
+            return key in diff;
+        });
+        if (touched) {
+            group.forEach(function (key) {
+                if (key in desired) {
+                    diff[key] = desired[key];
+                }
+            });
+        }
+    });
+    return diff;
+};
+
+exports.computeDiff = computeDiff;
@@ -0,0 +1,59 @@
+// Tests for common/diff: node common/diff_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+let computeDiff = testing.runtime().require("common/diff").computeDiff;
+
+test("an unchanged definition has an empty diff", function () {
+    let current = {"id": "P1", "name": "a", "tags": ["x"], "owner": {"id": "U1", "summary": "Ann"}, "timeout": null};
+    assert.deepStrictEqual(computeDiff(current, {"name": "a", "tags": ["x"], "owner": {"id": "U1"}}), {});
+    assert.deepStrictEqual(computeDiff(current, {"timeout": undefined}), {});
+});
+
+test("changed fields are in the diff, nested ones field by field", function () {
+    let current = {"name": "a", "settings": {"size": 1, "color": "red"}, "tags": ["x", "y"]};
+    let desired = {"name": "b", "settings": {"size": 2, "color": "red"}, "tags": ["x"]};
+    assert.deepStrictEqual(computeDiff(current, desired), {"name": "b", "settings": {"size": 2}, "tags": ["x"]});
+});
+
+test("ignore, whole and together shape the diff", function () {
+    let current = {"type": "a", "ref": {"id": "1", "type": "r"}, "from": 1, "to": 5};
+    let desired = {"type": "b", "ref": {"id": "2", "type": "r"}, "from": 1, "to": 6};
+    assert.deepStrictEqual(computeDiff(current, desired, {
+        "ignore": ["type"],
+        "whole": ["ref"],
+        "together": [["from", "to"]]
+    }), {"ref": {"id": "2", "type": "r"}, "from": 1, "to": 6});
+});
+
+test("pagerduty/service sends no update for an unchanged definition", function () {
+    let rt = testing.runtime();
+    rt.require("common/api").setRateLimiting(false);
+    rt.secrets["pd-token"] = "t";
+    let service = {
+        "id": "PS1", "type": "service", "name": "web", "description": "", "html_url": "https://pd/PS1",
+        "escalation_policy": {"id": "PE1", "type": "escalation_policy_reference", "summary": "Ops"},
+        "incident_urgency_rule": {"type": "constant", "urgency": "high"},
+        "acknowledgement_timeout": null, "auto_resolve_timeout": null
+    };
+    rt.handler = function () {
+        return {"body": JSON.stringify({"service": service})};
+    };
+    let main = rt.script("pagerduty/service-sync.js");
+    let def = {"name": "web", "token-secret": "pd-token", "escalation-policy": "PE1"};
+    main(def, {"id": "PS1"}, {"action": "update"});
+    assert.deepStrictEqual(rt.requests.map(function (r) {
+        return r.method;
+    }), ["GET"]);
+
+    def["escalation-policy"] = "PE2";
+    main(def, {"id": "PS1"}, {"action": "update"});
+    let put = rt.requests.find(function (r) {
+        return r.method === "PUT";
+    });
+    assert.deepStrictEqual(JSON.parse(put.body), {"service": {
+        "escalation_policy": {"id": "PE2", "type": "escalation_policy_reference"},
+        "type": "service"
+    }});
+});
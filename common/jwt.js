@@ -0,0 +1,369 @@
+// RS256 JSON Web Tokens signed with an RSA private key in PEM form, in plain
+// JavaScript as the entity runtime has no RSA of its own. Big integers are
+// arrays of 26-bit limbs, least significant first, so that a product of two
+// limbs plus carries stays exact in a double.
+let crypto = require("common/crypto");
+
+const LIMB_BITS = 26;
+const LIMB = 67108864; // 2^26
+const LIMB_INV = 1 / LIMB;
+
+// DigestInfo prefix of a SHA-256 hash in a PKCS#1 v1.5 signature, RFC 8017 9.2
+const SHA256_DIGEST_INFO = "3031300d060960864801650304020105000420";
+// AlgorithmIdentifier of rsaEncryption with NULL parameters
+const RSA_ALGORITHM = "300d06092a864886f70d0101010500";
+
+// --- big integers
+
+let fromBytes = function (bytes) {
+    let out = [];
+    let value = 0, bits = 0;
+    for (let i = bytes.length - 1; i >= 0; i--) {
+        value += bytes[i] * Math.pow(2, bits);
+        bits += 8;
+        if (bits >= LIMB_BITS) {
+            out.push(value % LIMB);
+            value = Math.floor(value / LIMB);
+            bits -= LIMB_BITS;
+        }
+    }
+    out.push(value);
+    return trim(out);
+};
+
+// toBytes returns the big-endian encoding of a, left-padded to size bytes
+let toBytes = function (a, size) {
+    let out = [];
+    let value = 0, bits = 0;
+    for (let i = 0; i < a.length; i++) {
+        value += a[i] * Math.pow(2, bits);
+        bits += LIMB_BITS;
+        while (bits >= 8) {
+            out.push(value % 256);
+            value = Math.floor(value / 256);
+            bits -= 8;
+        }
+    }
+    while (value > 0) {
+        out.push(value % 256);
+        value = Math.floor(value / 256);
+    }
+    while (out.length > size && out[out.length - 1] === 0) {
+        out.pop();
+    }
+    while (out.length < size) {
+        out.push(0);
+    }
+    return out.reverse();
+};
+
+let trim = function (a) {
+    while (a.length > 1 && a[a.length - 1] === 0) {
+        a.pop();
+    }
+    return a;
+};
+
+let compare = function (a, b) {
+    if (a.length !== b.length) {
+        return a.length < b.length ? -1 : 1;
+    }
+    for (let i = a.length - 1; i >= 0; i--) {
+        if (a[i] !== b[i]) {
+            return a[i] < b[i] ? -1 : 1;
+        }
+    }
+    return 0;
+};
+
+let add = function (a, b) {
+    let out = [];
+    let carry = 0;
+    for (let i = 0; i < Math.max(a.length, b.length); i++) {
+        let s = (a[i] || 0) + (b[i] || 0) + carry;
+        out.push(s % LIMB);
+        carry = s >= LIMB ? 1 : 0;
+    }
+    out.push(carry);
+    return trim(out);
+};
+
+// sub returns a - b for a >= b
+let sub = function (a, b) {
+    let out = [];
+    let borrow = 0;
+    for (let i = 0; i < a.length; i++) {
+        let s = a[i] - (b[i] || 0) - borrow;
+        borrow = s < 0 ? 1 : 0;
+        out.push(s < 0 ? s + LIMB : s);
+    }
+    return trim(out);
+};
+
+let mul = function (a, b) {
+    let out = [];
+    for (let i = 0; i < a.length + b.length; i++) {
+        out.push(0);
+    }
+    for (let i = 0; i < a.length; i++) {
+        let carry = 0;
+        for (let j = 0; j < b.length; j++) {
+            let s = out[i + j] + a[i] * b[j] + carry;
+            out[i + j] = s % LIMB;
+            carry = Math.floor(s / LIMB);
+        }
+        out[i + b.length] = carry;
+    }
+    return trim(out);
+};
+
+// mod reduces a modulo m bit by bit, which is only used once per modulus
+let mod = function (a, m) {
+    let r = [0];
+    for (let i = a.length - 1; i >= 0; i--) {
+        for (let bit = LIMB_BITS - 1; bit >= 0; bit--) {
+            r = add(r, r);
+            if (Math.floor(a[i] / Math.pow(2, bit)) % 2 === 1) {
+                r = add(r, [1]);
+            }
+            if (compare(r, m) >= 0) {
+                r = sub(r, m);
+            }
+        }
+    }
+    return r;
+};
+
+// montgomery holds what multiplications modulo the odd m need: R = 2^(26n)
+// for n limbs, -1/m mod 2^26 and R^2 mod m
+let montgomery = function (m) {
+    let n = m.length;
+    let inv = 1;
+    for (let bit = 1; bit < LIMB_BITS; bit++) {
+        if ((m[0] * inv) % Math.pow(2, bit + 1) !== 1) {
+            inv += Math.pow(2, bit);
+        }
+    }
+    let r2 = [1];
+    for (let i = 0; i < 2 * LIMB_BITS * n; i++) {
+        r2 = add(r2, r2);
+        if (compare(r2, m) >= 0) {
+            r2 = sub(r2, m);
+        }
+    }
+    return {"m": m, "n": n, "minv": LIMB - inv, "r2": r2};
+};
+
+// montMul returns a * b / R mod m, for a and b below m. Limbs are split with
+// a multiplication by 2^-26 rather than %, which is much slower on doubles.
+let montMul = function (mont, a, b) {
+    let m = mont.m, n = mont.n;
+    let t = [];
+    for (let i = 0; i < n + 2; i++) {
+        t.push(0);
+    }
+    for (let i = 0; i < n; i++) {
+        let bi = b[i] || 0;
+        let carry = 0, s = 0;
+        for (let j = 0; j < n; j++) {
+            s = t[j] + (a[j] || 0) * bi + carry;
+            carry = Math.floor(s * LIMB_INV);
+            t[j] = s - carry * LIMB;
+        }
+        s = t[n] + carry;
+        carry = Math.floor(s * LIMB_INV);
+        t[n] = s - carry * LIMB;
+        t[n + 1] = carry;
+
+        s = t[0] * mont.minv;
+        let q = s - Math.floor(s * LIMB_INV) * LIMB;
+        carry = Math.floor((t[0] + q * m[0]) * LIMB_INV);
+        for (let j = 1; j < n; j++) {
+            s = t[j] + q * m[j] + carry;
+            carry = Math.floor(s * LIMB_INV);
+            t[j - 1] = s - carry * LIMB;
+        }
+        s = t[n] + carry;
+        carry = Math.floor(s * LIMB_INV);
+        t[n - 1] = s - carry * LIMB;
+        t[n] = t[n + 1] + carry;
+        t[n + 1] = 0;
+    }
+    let out = trim(t.slice(0, n + 1));
+    return compare(out, m) >= 0 ? sub(out, m) : out;
+};
+
+// modPow returns base^exp mod m, with exp as big-endian bytes. The exponent
+// is taken four bits at a time, with the powers of base up to 15 precomputed.
+let modPow = function (base, exp, m) {
+    let mont = montgomery(m);
+    let powers = [montMul(mont, [1], mont.r2), montMul(mont, mod(base, m), mont.r2)];
+    for (let i = 2; i < 16; i++) {
+        powers.push(montMul(mont, powers[i - 1], powers[1]));
+    }
+    let result = powers[0];
+    for (let i = 0; i < exp.length; i++) {
+        [exp[i] >> 4, exp[i] & 15].forEach(function (nibble) {
+            for (let k = 0; k < 4; k++) {
+                result = montMul(mont, result, result);
+            }
+            if (nibble !== 0) {
+                result = montMul(mont, result, powers[nibble]);
+            }
+        });
+    }
+    return montMul(mont, result, [1]);
+};
+
+// --- DER
+
+// readDer reads the element at pos and returns its tag, the bounds of its
+// content and where the next element starts
+let readDer = function (bytes, pos) {
+    let tag = bytes[pos];
+    let length = bytes[pos + 1];
+    let start = pos + 2;
+    if (length & 0x80) {
+        let count = length & 0x7f;
+        length = 0;
+        for (let i = 0; i < count; i++) {
+            length = length * 256 + bytes[start + i];
+        }
+        start += count;
+    }
+    if (tag === undefined || start + length > bytes.length) {
+        throw new Error("truncated DER element at byte " + pos);
+    }
+    return {"tag": tag, "start": start, "end": start + length};
+};
+
+// readSequence returns the elements of the SEQUENCE at pos
+let readSequence = function (bytes, pos) {
+    let seq = readDer(bytes, pos);
+    if (seq.tag !== 0x30) {
+        throw new Error("expected a DER SEQUENCE at byte " + pos);
+    }
+    let items = [];
+    for (let p = seq.start; p < seq.end;) {
+        let item = readDer(bytes, p);
+        items.push(item);
+        p = item.end;
+    }
+    return items;
+};
+
+let integerBytes = function (bytes, item) {
+    if (item.tag !== 0x02) {
+        throw new Error("expected a DER INTEGER");
+    }
+    let out = bytes.slice(item.start, item.end);
+    while (out.length > 1 && out[0] === 0) {
+        out.shift();
+    }
+    return out;
+};
+
+let derLength = function (length) {
+    if (length < 0x80) {
+        return [length];
+    }
+    let out = [];
+    for (; length > 0; length = Math.floor(length / 256)) {
+        out.unshift(length % 256);
+    }
+    return [0x80 | out.length].concat(out);
+};
+
+let der = function (tag, content) {
+    return [tag].concat(derLength(content.length), content);
+};
+
+let derInteger = function (bytes) {
+    return der(0x02, bytes[0] & 0x80 ? [0].concat(bytes) : bytes);
+};
+
+// --- keys
+
+// privateKey parses an unencrypted RSA private key, either PKCS#8
+// ("BEGIN PRIVATE KEY") or PKCS#1 ("BEGIN RSA PRIVATE KEY")
+let privateKey = function (pem) {
+    let match = /-----BEGIN ([A-Z ]+)-----([\s\S]*?)-----END \1-----/.exec(pem || "");
+    if (!match) {
+        throw new Error("private key must be in PEM form");
+    }
+    let bytes = crypto.fromBase64(match[2].replace(/\s+/g, ""));
+    if (match[1] === "PRIVATE KEY") {
+        let info = readSequence(bytes, 0);
+        if (crypto.toHex(bytes.slice(info[1].start - 2, info[1].end)) !== RSA_ALGORITHM) {
+            throw new Error("private key is not an RSA key");
+        }
+        bytes = bytes.slice(info[2].start, info[2].end);
+    } else if (match[1] !== "RSA PRIVATE KEY") {
+        throw new Error("unsupported " + match[1] + ", expected an unencrypted RSA private key");
+    }
+    let fields = readSequence(bytes, 0).map(function (item) {
+        return integerBytes(bytes, item);
+    });
+    let names = ["version", "n", "e", "d", "p", "q", "dp", "dq", "qinv"];
+    let key = {};
+    names.forEach(function (name, i) {
+        key[name] = fields[i];
+    });
+    if (!key.qinv) {
+        throw new Error("RSA private key is missing its CRT parameters");
+    }
+    return key;
+};
+
+// publicKeyDer returns the DER SubjectPublicKeyInfo of a private key's public half
+let publicKeyDer = function (key) {
+    let rsaKey = der(0x30, derInteger(key.n).concat(derInteger(key.e)));
+    return der(0x30, crypto.fromHex(RSA_ALGORITHM).concat(der(0x03, [0].concat(rsaKey))));
+};
+
+// signRS256 returns the RSASSA-PKCS1-v1_5 SHA-256 signature of message,
+// computed with the CRT parameters and checked against the public exponent
+let signRS256 = function (key, message) {
+    let size = key.n.length;
+    let t = crypto.fromHex(SHA256_DIGEST_INFO).concat(crypto.sha256(message));
+    if (size < t.length + 11) {
+        throw new Error("RSA key is too short");
+    }
+    let em = [0, 1];
+    for (let i = 0; i < size - t.length - 3; i++) {
+        em.push(0xff);
+    }
+    em = em.concat([0], t);
+
+    let c = fromBytes(em);
+    let p = fromBytes(key.p), q = fromBytes(key.q);
+    let m1 = modPow(c, key.dp, p);
+    let m2 = modPow(c, key.dq, q);
+    let diff = mod(m2, p);
+    diff = compare(m1, diff) >= 0 ? sub(m1, diff) : sub(add(m1, p), diff);
+    let mont = montgomery(p);
+    let h = montMul(mont, montMul(mont, mod(fromBytes(key.qinv), p), mont.r2), diff);
+    let s = add(m2, mul(h, q));
+
+    if (compare(modPow(s, key.e, fromBytes(key.n)), c) !== 0) {
+        throw new Error("RSA signature check failed, the private key is inconsistent");
+    }
+    return toBytes(s, size);
+};
+
+let base64Url = function (bytes) {
+    return crypto.toBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+};
+
+// sign returns a compact RS256 JWT of the claims, with key from privateKey
+let sign = function (claims, key) {
+    let input = base64Url(crypto.utf8Bytes(JSON.stringify({"alg": "RS256", "typ": "JWT"}))) + "." +
+        base64Url(crypto.utf8Bytes(JSON.stringify(claims)));
+    return input + "." + base64Url(signRS256(key, input));
+};
+
+exports.privateKey = privateKey;
+exports.publicKeyDer = publicKeyDer;
+exports.signRS256 = signRS256;
+exports.base64Url = base64Url;
+exports.sign = sign;
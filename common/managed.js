@@ -0,0 +1,50 @@
+// Marks for the resources entities create, so that they can find them again,
+// e.g. to adopt one or to tell the ones a failed run left behind.
+
+// MANAGED marks a resource as created by a Monk entity, ENTITY names the
+// entity by a key of its definition, such as the resource's name
+const MANAGED = "monk-managed";
+const ENTITY = "monk-entity";
+
+// NAME_PREFIX starts the names of managed resources of providers without
+// tags or metadata
+const NAME_PREFIX = "monk-";
+
+// managedTags returns the tags marking a resource of the entity with key
+let managedTags = function (key) {
+    let tags = {};
+    tags[MANAGED] = "true";
+    tags[ENTITY] = String(key);
+    return tags;
+};
+
+// applyManagedTags returns a copy of a resource's tags or metadata with the
+// managed tags added
+let applyManagedTags = function (tags, key) {
+    return Object.assign({}, tags, managedTags(key));
+};
+
+// isManaged tells whether tags mark a managed resource, of the entity with
+// key when one is given
+let isManaged = function (tags, key) {
+    tags = tags || {};
+    return tags[MANAGED] === "true" && (key === undefined || tags[ENTITY] === String(key));
+};
+
+// managedName returns the name of a resource for providers that can't tag
+// it, with the prefix marking it as managed
+let managedName = function (name) {
+    return name.indexOf(NAME_PREFIX) === 0 ? name : NAME_PREFIX + name;
+};
+
+let isManagedName = function (name) {
+    return name.indexOf(NAME_PREFIX) === 0;
+};
+
+exports.MANAGED = MANAGED;
+exports.ENTITY = ENTITY;
+exports.managedTags = managedTags;
+exports.applyManagedTags = applyManagedTags;
+exports.isManaged = isManaged;
+exports.managedName = managedName;
+exports.isManagedName = isManagedName;
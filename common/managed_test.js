@@ -0,0 +1,40 @@
+// Tests for common/managed: node common/managed_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+test("managed tags mark a resource of an entity", function () {
+    let managed = testing.runtime().require("common/managed");
+    let tags = managed.applyManagedTags({"tier": "pro"}, "Pro plan");
+    assert.deepStrictEqual(tags, {"tier": "pro", "monk-managed": "true", "monk-entity": "Pro plan"});
+    assert.ok(managed.isManaged(tags));
+    assert.ok(managed.isManaged(tags, "Pro plan"));
+    assert.ok(!managed.isManaged(tags, "Basic plan"));
+    assert.ok(!managed.isManaged({"tier": "pro"}));
+    assert.ok(!managed.isManaged(undefined));
+});
+
+test("managed names carry the prefix once", function () {
+    let managed = testing.runtime().require("common/managed");
+    assert.strictEqual(managed.managedName("cache"), "monk-cache");
+    assert.strictEqual(managed.managedName("monk-cache"), "monk-cache");
+    assert.ok(managed.isManagedName("monk-cache"));
+    assert.ok(!managed.isManagedName("cache"));
+});
+
+test("stripe/common finds managed objects through search", function () {
+    let rt = testing.runtime();
+    rt.secrets["sk"] = "sk_test";
+    let pages = [
+        {"data": [{"id": "prod_1"}], "has_more": true, "next_page": "p2"},
+        {"data": [{"id": "prod_2"}], "has_more": false, "next_page": null}
+    ];
+    rt.handler = function () {
+        return {"body": JSON.stringify(pages.shift())};
+    };
+    let found = rt.require("stripe/common").findManaged({"api-key-secret": "sk"}, "products", "Pro's plan");
+    assert.deepStrictEqual(found, [{"id": "prod_1"}, {"id": "prod_2"}]);
+    let query = "metadata['monk-managed']:'true' AND metadata['monk-entity']:'Pro\\'s plan'";
+    assert.strictEqual(rt.requests[0].url, "https://api.stripe.com/v1/products/search?query=" + encodeURIComponent(query));
+    assert.strictEqual(rt.requests[1].url, rt.requests[0].url + "&page=p2");
+});
@@ -0,0 +1,79 @@
+// Migrations of entity state saved by older versions of a sync script, so the
+// script only has to read the current shape.
+//
+// A script lists its migrations in order, the first one taking version 1
+// state, which has no stateVersion, to version 2:
+//
+//     let MIGRATIONS = [
+//         {"rename": {"hash": "value-hash"}},
+//         {"up": function (state) { ... return state; }}
+//     ];
+
+// VERSION_KEY is the state field holding the version of the state's shape
+const VERSION_KEY = "stateVersion";
+
+// current is the version of state all the migrations have been applied to
+let current = function (migrations) {
+    return migrations.length + 1;
+};
+
+// renameFields returns a copy of state with the fields renamed from the keys
+// of names to their values
+let renameFields = function (state, names) {
+    let out = {};
+    for (let key in state) {
+        out[key in names ? names[key] : key] = state[key];
+    }
+    return out;
+};
+
+// migrate returns state brought to the current version by the migrations it
+// hasn't seen. Empty state, as before a create, is left alone. State from a
+// newer script is refused rather than read in a shape this one doesn't know.
+let migrate = function (state, migrations) {
+    if (!state || Object.keys(state).length === 0) {
+        return state;
+    }
+    let version = state[VERSION_KEY] || 1;
+    if (version > current(migrations)) {
+        throw new Error("state has version " + version + ", newer than the " + current(migrations) +
+            " this entity reads; update the entity");
+    }
+    for (; version < current(migrations); version++) {
+        let migration = migrations[version - 1];
+        if (migration.rename) {
+            state = renameFields(state, migration.rename);
+        }
+        if (migration.up) {
+            state = migration.up(Object.assign({}, state));
+        }
+    }
+    return stamp(state, migrations);
+};
+
+// stamp returns a copy of state marked with the current version
+let stamp = function (state, migrations) {
+    if (!state) {
+        return state;
+    }
+    let out = Object.assign({}, state);
+    out[VERSION_KEY] = current(migrations);
+    return out;
+};
+
+// versioned wraps a script's action function, migrating the state before the
+// action and marking the state it returns with the current version:
+//
+//     function main(def, state, ctx) {
+//         return migrations.versioned(MIGRATIONS, run)(def, state, ctx);
+//     }
+let versioned = function (migrations, fn) {
+    return function (def, state, ctx) {
+        return stamp(fn(def, migrate(state, migrations), ctx), migrations);
+    };
+};
+
+exports.VERSION_KEY = VERSION_KEY;
+exports.migrate = migrate;
+exports.stamp = stamp;
+exports.versioned = versioned;
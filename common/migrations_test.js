@@ -0,0 +1,52 @@
+// Tests for common/migrations: node common/migrations_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+let MIGRATIONS = [
+    {"rename": {"hash": "value-hash"}}
+];
+
+test("version 1 state is migrated to version 2 by renaming a field", function () {
+    let migrations = testing.runtime().require("common/migrations");
+    let state = migrations.migrate({"id": "env_1", "hash": "abc"}, MIGRATIONS);
+    assert.deepStrictEqual(state, {"id": "env_1", "value-hash": "abc", "stateVersion": 2});
+    assert.deepStrictEqual(migrations.migrate(state, MIGRATIONS), state);
+});
+
+test("migrations run in order from the stored version", function () {
+    let migrations = testing.runtime().require("common/migrations");
+    let steps = MIGRATIONS.concat([{
+        "up": function (state) {
+            state["targets"] = [state["target"]];
+            delete state["target"];
+            return state;
+        }
+    }]);
+    assert.deepStrictEqual(migrations.migrate({"hash": "abc", "target": "production"}, steps),
+        {"value-hash": "abc", "targets": ["production"], "stateVersion": 3});
+    assert.deepStrictEqual(migrations.migrate({"value-hash": "abc", "target": "preview", "stateVersion": 2}, steps),
+        {"value-hash": "abc", "targets": ["preview"], "stateVersion": 3});
+});
+
+test("state of a newer version is refused", function () {
+    let migrations = testing.runtime().require("common/migrations");
+    assert.throws(function () {
+        migrations.migrate({"value-hash": "abc", "stateVersion": 3}, MIGRATIONS);
+    }, /state has version 3, newer than the 2 this entity reads/);
+});
+
+test("versioned actions read migrated state and return stamped state", function () {
+    let migrations = testing.runtime().require("common/migrations");
+    let seen;
+    let main = migrations.versioned(MIGRATIONS, function (def, state, ctx) {
+        seen = state;
+        return ctx.action === "purge" ? undefined : {"id": state["id"], "value-hash": "def"};
+    });
+    assert.deepStrictEqual(main({}, {"id": "env_1", "hash": "abc"}, {"action": "update"}),
+        {"id": "env_1", "value-hash": "def", "stateVersion": 2});
+    assert.deepStrictEqual(seen, {"id": "env_1", "value-hash": "abc", "stateVersion": 2});
+    assert.strictEqual(main({}, {"id": "env_1"}, {"action": "purge"}), undefined);
+    main({}, {}, {"action": "create"});
+    assert.deepStrictEqual(seen, {});
+});
@@ -0,0 +1,57 @@
+// Names for the resources entities create, composed from a prefix and the
+// entity's path with a short hash, so that two stacks with entities of the
+// same name get different resources while every run of one entity gets the
+// same name and finds its resource again.
+let crypto = require("common/crypto");
+
+// RULES are the naming rules of a kind of resource: the characters allowed
+// (anything else becomes "-", or is dropped where "-" isn't allowed either),
+// the longest name, whether names are lowercase and what a name has to start
+// with.
+const RULES = {
+    "default": {"allowed": /[a-z0-9-]/, "max": 63, "lowercase": true, "start": /[a-z0-9]/},
+    "aws/s3-bucket": {"allowed": /[a-z0-9-]/, "max": 63, "lowercase": true, "start": /[a-z0-9]/},
+    "aws/dynamodb": {"allowed": /[A-Za-z0-9_.-]/, "max": 255, "lowercase": false, "start": /./},
+    "aws/sqs-queue": {"allowed": /[A-Za-z0-9_-]/, "max": 80, "lowercase": false, "start": /./},
+    "aws/iam": {"allowed": /[A-Za-z0-9+=,.@_-]/, "max": 64, "lowercase": false, "start": /./},
+    "azure/storage-account": {"allowed": /[a-z0-9]/, "max": 24, "lowercase": true, "start": /[a-z0-9]/},
+    "azure/blob-container": {"allowed": /[a-z0-9-]/, "max": 63, "lowercase": true, "start": /[a-z0-9]/},
+    "gcp/service-account": {"allowed": /[a-z0-9-]/, "max": 30, "lowercase": true, "start": /[a-z]/},
+    "cloudflare/r2-bucket": {"allowed": /[a-z0-9-]/, "max": 63, "lowercase": true, "start": /[a-z0-9]/},
+    "digitalocean/spaces-bucket": {"allowed": /[a-z0-9-]/, "max": 63, "lowercase": true, "start": /[a-z0-9]/}
+};
+
+// HASH_LENGTH is the number of hex digits of the hash ending a name
+const HASH_LENGTH = 8;
+
+// clean returns part with the characters the rules don't allow replaced, and
+// runs of separators collapsed
+let clean = function (part, rules) {
+    let out = "";
+    let chars = rules.lowercase ? part.toLowerCase() : part;
+    let separator = rules.allowed.test("-") ? "-" : "";
+    for (let i = 0; i < chars.length; i++) {
+        out += rules.allowed.test(chars[i]) ? chars[i] : separator;
+    }
+    return out.replace(/-+/g, "-").replace(/^-|-$/g, "");
+};
+
+// resourceName returns the name of a resource of kind, a key of RULES, for the
+// entity at path, e.g. "prod/db", starting with prefix. The hash is of the
+// prefix and the full path, so names that are cut to fit still differ. A kind
+// without rules gets the default ones.
+let resourceName = function (kind, prefix, path) {
+    let rules = RULES[kind] || RULES["default"];
+    let hash = crypto.toHex(crypto.sha256(crypto.utf8Bytes(prefix + "\u0000" + path))).substring(0, HASH_LENGTH);
+    let separator = rules.allowed.test("-") ? "-" : "";
+    let base = [clean(prefix, rules), clean(path, rules)].filter(Boolean).join(separator);
+    base = base.substring(0, rules.max - HASH_LENGTH - separator.length).replace(/-$/, "");
+    let name = base ? base + separator + hash : hash;
+    if (!rules.start.test(name[0])) {
+        throw new Error("a name for " + kind + " must start with " + rules.start.source + ", " + name + " doesn't");
+    }
+    return name;
+};
+
+exports.RULES = RULES;
+exports.resourceName = resourceName;
@@ -0,0 +1,33 @@
+// Tests for common/naming: node common/naming_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+test("names are stable and differ between stacks", function () {
+    let naming = testing.runtime().require("common/naming");
+    let name = naming.resourceName("aws/s3-bucket", "acme", "prod/Assets_Bucket");
+    assert.match(name, /^acme-prod-assets-bucket-[0-9a-f]{8}$/);
+    assert.strictEqual(naming.resourceName("aws/s3-bucket", "acme", "prod/Assets_Bucket"), name);
+    assert.notStrictEqual(naming.resourceName("aws/s3-bucket", "acme", "staging/Assets_Bucket"), name);
+});
+
+test("names are cut to the provider's length and keep the hash", function () {
+    let naming = testing.runtime().require("common/naming");
+    let long = "team/" + "a".repeat(80);
+    let name = naming.resourceName("azure/storage-account", "Acme Corp", long);
+    assert.strictEqual(name.length, 24);
+    assert.match(name, /^acmecorpteama+[0-9a-f]{8}$/);
+    let other = naming.resourceName("azure/storage-account", "Acme Corp", long + "b");
+    assert.strictEqual(other.length, 24);
+    assert.notStrictEqual(other, name);
+});
+
+test("each provider's characters are kept or replaced", function () {
+    let naming = testing.runtime().require("common/naming");
+    assert.match(naming.resourceName("aws/dynamodb", "App", "prod/Orders.v2"), /^App-prod-Orders\.v2-[0-9a-f]{8}$/);
+    assert.match(naming.resourceName("gcp/service-account", "", "ci/deployer"), /^ci-deployer-[0-9a-f]{8}$/);
+    assert.match(naming.resourceName("unknown/kind", "", "--Prod//DB--"), /^prod-db-[0-9a-f]{8}$/);
+    assert.throws(function () {
+        naming.resourceName("gcp/service-account", "", "42/runner");
+    }, /must start with \[a-z\]/);
+});
@@ -0,0 +1,78 @@
+// Outputs computed from an entity's state, such as a connection string or a
+// console URL, declared in its definition:
+//
+//     outputs:
+//       console-url: "https://console.neon.tech/app/projects/${project-id}"
+//       app-url:
+//         template: "postgres://app:${secret:app-password}@${host}/${database-name}"
+//         secret: app-url
+let cli = require("cli");
+let secret = require("secret");
+
+const MASK = "***";
+
+let FIELD = /\$\{([^}]+)\}/g;
+
+// render fills in a template from values, the entity's state and definition.
+// ${secret:name} is replaced by the Monk secret name. It returns the value,
+// the value with the secrets masked for printing, whether it has secrets, and
+// the fields that have no value yet, in which case the value is undefined.
+let render = function (template, values) {
+    let missing = [];
+    let secrets = false;
+    let fill = function (mask) {
+        return template.replace(FIELD, function (match, name) {
+            if (name.indexOf("secret:") === 0) {
+                secrets = true;
+                return mask ? MASK : secret.get(name.substring("secret:".length));
+            }
+            let value = values[name];
+            if (value === undefined || value === null || value === "") {
+                missing.push(name);
+                return match;
+            }
+            return String(value);
+        });
+    };
+    let masked = fill(true);
+    if (missing.length > 0) {
+        return {"missing": missing, "masked": masked, "secrets": secrets};
+    }
+    return {"value": fill(false), "masked": masked, "missing": [], "secrets": secrets};
+};
+
+// apply evaluates the outputs of a definition after an action and returns the
+// state with the plain ones under "outputs". An output with a secret
+// interpolated goes to the Monk secret it names and is only printed masked, so
+// it never reaches the state. Outputs whose fields aren't in the state yet,
+// such as a host known once the resource is ready, are left out until a
+// later action.
+let apply = function (def, state) {
+    let outputs = def["outputs"];
+    if (!outputs || !state) {
+        return state;
+    }
+    let values = Object.assign({}, def, state);
+    let plain = {};
+    for (let name in outputs) {
+        let output = typeof outputs[name] === "string" ? {"template": outputs[name]} : outputs[name];
+        let result = render(output["template"], values);
+        if (result.missing.length > 0) {
+            continue;
+        }
+        if (output["secret"]) {
+            secret.set(output["secret"], result.value);
+            cli.output(name + ": " + result.masked + " (in secret " + output["secret"] + ")");
+            continue;
+        }
+        if (result.secrets) {
+            throw new Error("output " + name + " interpolates a secret, set secret to the Monk secret to write it to");
+        }
+        plain[name] = result.value;
+        cli.output(name + ": " + result.value);
+    }
+    return Object.assign({}, state, {"outputs": plain});
+};
+
+exports.render = render;
+exports.apply = apply;
@@ -0,0 +1,250 @@
+// Buckets of S3-compatible object storage outside AWS, such as Cloudflare R2
+// and DigitalOcean Spaces, through the S3 API with SigV4. A provider entity
+// describes its endpoint once:
+//
+//     let r2 = s3.client({
+//         "name": "Cloudflare R2",
+//         "endpoint": function (def) {
+//             return "https://" + def["account-id"] + ".r2.cloudflarestorage.com";
+//         },
+//         "region": function () {
+//             return "auto";
+//         }
+//     });
+//
+// Requests go to path-style URLs, https://<endpoint>/<bucket>, and are signed
+// with the access key ID in the definition's access-key-id and the secret
+// access key in the Monk secret named in secret-access-key-secret.
+let parser = require("parser");
+let secret = require("secret");
+let api = require("common/api");
+let crypto = require("common/crypto");
+let sigv4 = require("common/sigv4");
+
+const S3_NS = "http://s3.amazonaws.com/doc/2006-03-01/";
+
+// DELETE_BATCH is the most keys a DeleteObjects request takes
+const DELETE_BATCH = 1000;
+
+let escapeXml = function (value) {
+    return String(value).replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;")
+        .replace(/"/g, "&quot;").replace(/'/g, "&apos;");
+};
+
+// element returns <name>value</name> for each of values, or for value alone
+let element = function (name, values) {
+    return [].concat(values).map(function (value) {
+        return "<" + name + ">" + escapeXml(value) + "</" + name + ">";
+    }).join("");
+};
+
+// corsXml returns the CORS configuration of the rules of a definition's
+// cors-rules: origins, methods, headers, expose-headers and max-age
+let corsXml = function (rules) {
+    return "<CORSConfiguration xmlns=\"" + S3_NS + "\">" + rules.map(function (rule) {
+        return "<CORSRule>" +
+            element("AllowedOrigin", rule["origins"] || ["*"]) +
+            element("AllowedMethod", rule["methods"] || ["GET"]) +
+            element("AllowedHeader", rule["headers"] || []) +
+            element("ExposeHeader", rule["expose-headers"] || []) +
+            (rule["max-age"] ? element("MaxAgeSeconds", rule["max-age"]) : "") +
+            "</CORSRule>";
+    }).join("") + "</CORSConfiguration>";
+};
+
+// lifecycleXml returns the lifecycle configuration of the rules of a
+// definition's lifecycle-rules: id, prefix, expire-days and
+// abort-multipart-days
+let lifecycleXml = function (rules) {
+    return "<LifecycleConfiguration xmlns=\"" + S3_NS + "\">" + rules.map(function (rule, i) {
+        let xml = "<Rule>" + element("ID", rule["id"] || "rule-" + (i + 1)) +
+            "<Filter>" + element("Prefix", rule["prefix"] || "") + "</Filter>" +
+            element("Status", "Enabled");
+        if (rule["expire-days"]) {
+            xml += "<Expiration>" + element("Days", rule["expire-days"]) + "</Expiration>";
+        }
+        if (rule["abort-multipart-days"]) {
+            xml += "<AbortIncompleteMultipartUpload>" + element("DaysAfterInitiation", rule["abort-multipart-days"]) +
+                "</AbortIncompleteMultipartUpload>";
+        }
+        return xml + "</Rule>";
+    }).join("") + "</LifecycleConfiguration>";
+};
+
+// contentMd5 returns the Content-MD5 header of a body, which S3 requires for
+// configuration and batch delete requests
+let contentMd5 = function (body) {
+    return {"Content-MD5": crypto.toBase64(crypto.md5(body))};
+};
+
+// client returns the bucket functions of an S3-compatible provider. config
+// holds the provider's name and functions of the definition returning the
+// endpoint URL and the signing region.
+let client = function (config) {
+    let s3 = api.client({
+        "name": config.name,
+        "baseUrl": config.endpoint,
+        "headers": function () {
+            return {};
+        },
+        "encode": function (body) {
+            return body;
+        },
+        "contentType": "application/xml",
+        "parseError": function (body) {
+            return {
+                "message": parser.xmlquery(body, "//Error/Message")[0],
+                "code": parser.xmlquery(body, "//Error/Code")[0]
+            };
+        },
+        "message": function (body) {
+            return body.message;
+        },
+        "code": function (body) {
+            return body.code;
+        },
+        "sign": function (def, method, url, headers, body) {
+            if (!def["access-key-id"] || !def["secret-access-key-secret"]) {
+                throw new Error("access-key-id and secret-access-key-secret must be set");
+            }
+            return sigv4.sign(method, url, headers, body, {
+                "access-key": def["access-key-id"],
+                "secret-key": secret.get(def["secret-access-key-secret"]),
+                "region": config.region(def),
+                "service": "s3"
+            });
+        }
+    });
+
+    let path = function (bucket, query) {
+        return "/" + encodeURIComponent(bucket) + (query ? "?" + query : "");
+    };
+
+    // clear deletes a configuration of the bucket, such as its CORS rules,
+    // which may not exist
+    let clear = function (def, bucket, what) {
+        try {
+            s3.send(def, "delete", path(bucket, what));
+        } catch (e) {
+            if (!api.isNotFound(e)) {
+                throw e;
+            }
+        }
+    };
+
+    // exists tells whether the bucket exists and the credentials can reach it
+    let exists = function (def, bucket) {
+        try {
+            s3.send(def, "head", path(bucket));
+            return true;
+        } catch (e) {
+            if (api.isNotFound(e)) {
+                return false;
+            }
+            throw e;
+        }
+    };
+
+    // createBucket creates a bucket, in location when one is given, with a
+    // canned ACL, e.g. "private" or "public-read", when one is given
+    let createBucket = function (def, bucket, opts) {
+        opts = opts || {};
+        let body;
+        if (opts.location) {
+            body = "<CreateBucketConfiguration xmlns=\"" + S3_NS + "\">" +
+                element("LocationConstraint", opts.location) + "</CreateBucketConfiguration>";
+        }
+        s3.send(def, "put", path(bucket), body, {"headers": opts.acl ? {"x-amz-acl": opts.acl} : {}});
+    };
+
+    let setAcl = function (def, bucket, acl) {
+        s3.send(def, "put", path(bucket, "acl"), undefined, {"headers": {"x-amz-acl": acl}});
+    };
+
+    // setCors replaces the bucket's CORS rules, removing them when there are
+    // none
+    let setCors = function (def, bucket, rules) {
+        if (!rules || rules.length === 0) {
+            clear(def, bucket, "cors");
+            return;
+        }
+        let body = corsXml(rules);
+        s3.send(def, "put", path(bucket, "cors"), body, {"headers": contentMd5(body)});
+    };
+
+    // setLifecycle replaces the bucket's lifecycle rules, removing them when
+    // there are none
+    let setLifecycle = function (def, bucket, rules) {
+        if (!rules || rules.length === 0) {
+            clear(def, bucket, "lifecycle");
+            return;
+        }
+        let body = lifecycleXml(rules);
+        s3.send(def, "put", path(bucket, "lifecycle"), body, {"headers": contentMd5(body)});
+    };
+
+    // listKeys returns the keys of the first page of the bucket's objects
+    let listKeys = function (def, bucket) {
+        let body = s3.send(def, "get", path(bucket, "list-type=2&max-keys=" + DELETE_BATCH), undefined,
+            {"cache": false}).body;
+        return parser.xmlquery(body, "//Contents/Key");
+    };
+
+    // emptyBucket deletes the bucket's objects a page at a time, listing the
+    // first page again after each, and returns how many it deleted
+    let emptyBucket = function (def, bucket) {
+        let count = 0;
+        for (;;) {
+            let keys = listKeys(def, bucket);
+            if (keys.length === 0) {
+                return count;
+            }
+            let body = "<Delete xmlns=\"" + S3_NS + "\"><Quiet>true</Quiet>" + keys.map(function (key) {
+                return "<Object>" + element("Key", key) + "</Object>";
+            }).join("") + "</Delete>";
+            let res = s3.send(def, "post", path(bucket, "delete"), body, {
+                "headers": contentMd5(body),
+                "idempotent": true,
+                "operation": "delete"
+            });
+            let failed = parser.xmlquery(res.body, "//Error/Key");
+            if (failed.length > 0) {
+                throw new Error("deleting " + failed.length + " objects of " + bucket + " failed, e.g. " + failed[0] +
+                    ": " + parser.xmlquery(res.body, "//Error/Message")[0]);
+            }
+            count += keys.length;
+        }
+    };
+
+    // deleteBucket deletes the bucket. A bucket that still holds objects is
+    // refused by the provider, unless force empties it first; a bucket that
+    // is gone already counts as deleted.
+    let deleteBucket = function (def, bucket, force) {
+        if (force && exists(def, bucket)) {
+            api.log(def, "info", "Deleted " + emptyBucket(def, bucket) + " objects from " + bucket);
+        }
+        try {
+            s3.remove(def, path(bucket));
+        } catch (e) {
+            if (e.code === "BucketNotEmpty") {
+                throw new Error("bucket " + bucket + " is not empty, set force-delete to delete its objects too");
+            }
+            throw e;
+        }
+    };
+
+    return {
+        "send": s3.send,
+        "exists": exists,
+        "createBucket": createBucket,
+        "setAcl": setAcl,
+        "setCors": setCors,
+        "setLifecycle": setLifecycle,
+        "emptyBucket": emptyBucket,
+        "deleteBucket": deleteBucket
+    };
+};
+
+exports.corsXml = corsXml;
+exports.lifecycleXml = lifecycleXml;
+exports.client = client;
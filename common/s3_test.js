@@ -0,0 +1,145 @@
+// Tests for common/s3: node common/s3_test.js
+const crypto = require("crypto");
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+const DEF = {"account": "acc", "access-key-id": "AKID", "secret-access-key-secret": "s3-secret"};
+
+let setup = function () {
+    let rt = testing.runtime();
+    rt.secrets["s3-secret"] = "SECRET";
+    let s3 = rt.require("common/s3");
+    let client = s3.client({
+        "name": "Test",
+        "endpoint": function (def) {
+            return "https://" + def["account"] + ".storage.test";
+        },
+        "region": function () {
+            return "auto";
+        }
+    });
+    return {"rt": rt, "s3": s3, "client": client};
+};
+
+let md5 = function (body) {
+    return crypto.createHash("md5").update(body).digest("base64");
+};
+
+test("requests are signed with SigV4 for the provider's region", function () {
+    let t = setup();
+    t.client.createBucket(DEF, "assets", {"location": "weur", "acl": "private"});
+    let req = t.rt.requests[0];
+    assert.strictEqual(req.method, "PUT");
+    assert.strictEqual(req.url, "https://acc.storage.test/assets");
+    assert.match(req.headers["Authorization"],
+        /^AWS4-HMAC-SHA256 Credential=AKID\/\d{8}\/auto\/s3\/aws4_request, SignedHeaders=content-type;host;x-amz-acl;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$/);
+    assert.strictEqual(req.headers["x-amz-acl"], "private");
+    assert.strictEqual(req.headers["X-Amz-Content-Sha256"], crypto.createHash("sha256").update(req.body).digest("hex"));
+    assert.match(req.body, /<LocationConstraint>weur<\/LocationConstraint>/);
+});
+
+test("a definition without credentials is refused", function () {
+    let t = setup();
+    assert.throws(function () {
+        t.client.exists({"account": "acc"}, "assets");
+    }, /access-key-id and secret-access-key-secret must be set/);
+    assert.strictEqual(t.rt.requests.length, 0);
+});
+
+test("exists tells a missing bucket from a forbidden one", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 404};
+    };
+    assert.strictEqual(t.client.exists(DEF, "assets"), false);
+    t.rt.handler = function () {
+        return {"statusCode": 403, "body": "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"};
+    };
+    assert.throws(function () {
+        t.client.exists(DEF, "assets");
+    }, /response code 403, Access Denied/);
+});
+
+test("CORS and lifecycle rules are sent as XML with their Content-MD5", function () {
+    let t = setup();
+    t.client.setCors(DEF, "assets", [{"origins": ["https://a.test"], "methods": ["GET", "PUT"], "max-age": 60}]);
+    t.client.setLifecycle(DEF, "assets", [{"prefix": "tmp/", "expire-days": 7}, {"abort-multipart-days": 1}]);
+    let cors = t.rt.requests[0];
+    assert.strictEqual(cors.url, "https://acc.storage.test/assets?cors");
+    assert.strictEqual(cors.body, "<CORSConfiguration xmlns=\"http://s3.amazonaws.com/doc/2006-03-01/\"><CORSRule>" +
+        "<AllowedOrigin>https://a.test</AllowedOrigin><AllowedMethod>GET</AllowedMethod><AllowedMethod>PUT</AllowedMethod>" +
+        "<MaxAgeSeconds>60</MaxAgeSeconds></CORSRule></CORSConfiguration>");
+    assert.strictEqual(cors.headers["Content-MD5"], md5(cors.body));
+    let lifecycle = t.rt.requests[1];
+    assert.strictEqual(lifecycle.url, "https://acc.storage.test/assets?lifecycle");
+    assert.match(lifecycle.body, /<Rule><ID>rule-1<\/ID><Filter><Prefix>tmp\/<\/Prefix><\/Filter><Status>Enabled<\/Status><Expiration><Days>7<\/Days><\/Expiration><\/Rule>/);
+    assert.match(lifecycle.body, /<AbortIncompleteMultipartUpload><DaysAfterInitiation>1<\/DaysAfterInitiation>/);
+    assert.strictEqual(lifecycle.headers["Content-MD5"], md5(lifecycle.body));
+});
+
+test("no rules remove the configuration, which may be missing", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 404, "body": "<Error><Code>NoSuchCORSConfiguration</Code></Error>"};
+    };
+    t.client.setCors(DEF, "assets", []);
+    assert.strictEqual(t.rt.requests[0].method, "DELETE");
+    assert.strictEqual(t.rt.requests[0].url, "https://acc.storage.test/assets?cors");
+    assert.deepStrictEqual(t.rt.output, []);
+});
+
+test("a non-empty bucket is not deleted unless forced", function () {
+    let t = setup();
+    t.rt.handler = function () {
+        return {"statusCode": 409, "body": "<Error><Code>BucketNotEmpty</Code><Message>not empty</Message></Error>"};
+    };
+    assert.throws(function () {
+        t.client.deleteBucket(DEF, "assets", false);
+    }, /^Error: bucket assets is not empty, set force-delete to delete its objects too$/);
+    assert.strictEqual(t.rt.requests.length, 1);
+});
+
+test("a forced delete empties the bucket first", function () {
+    let t = setup();
+    let pages = [
+        "<ListBucketResult><Contents><Key>a.txt</Key></Contents><Contents><Key>b&amp;c</Key></Contents></ListBucketResult>",
+        "<ListBucketResult></ListBucketResult>"
+    ];
+    t.rt.handler = function (req) {
+        if (req.method === "GET") {
+            return {"statusCode": 200, "body": pages.shift()};
+        }
+        return {"statusCode": req.method === "DELETE" ? 204 : 200, "body": req.method === "POST" ? "<DeleteResult/>" : ""};
+    };
+    t.client.deleteBucket(DEF, "assets", true);
+    assert.deepStrictEqual(t.rt.requests.map(function (req) {
+        return req.method + " " + req.url;
+    }), [
+        "HEAD https://acc.storage.test/assets",
+        "GET https://acc.storage.test/assets?list-type=2&max-keys=1000",
+        "POST https://acc.storage.test/assets?delete",
+        "GET https://acc.storage.test/assets?list-type=2&max-keys=1000",
+        "DELETE https://acc.storage.test/assets"
+    ]);
+    let batch = t.rt.requests[2];
+    assert.match(batch.body, /<Object><Key>a.txt<\/Key><\/Object><Object><Key>b&amp;c<\/Key><\/Object>/);
+    assert.strictEqual(batch.headers["Content-MD5"], md5(batch.body));
+    assert.deepStrictEqual(t.rt.output, ["Deleted 2 objects from assets"]);
+});
+
+test("objects that fail to delete fail the delete", function () {
+    let t = setup();
+    t.rt.handler = function (req) {
+        if (req.method === "GET") {
+            return {"statusCode": 200, "body": "<ListBucketResult><Contents><Key>a.txt</Key></Contents></ListBucketResult>"};
+        }
+        if (req.method === "POST") {
+            return {"statusCode": 200, "body": "<DeleteResult><Error><Key>a.txt</Key><Message>denied</Message></Error></DeleteResult>"};
+        }
+        return {"statusCode": 200};
+    };
+    assert.throws(function () {
+        t.client.emptyBucket(DEF, "assets");
+    }, /^Error: deleting 1 objects of assets failed, e.g. a.txt: denied$/);
+});
@@ -0,0 +1,118 @@
+// AWS Signature Version 4 for the S3-compatible APIs that aren't AWS, such as
+// Cloudflare R2 and DigitalOcean Spaces. AWS entities get their requests
+// signed by the runtime's cloud/aws module instead, which only knows AWS
+// credentials.
+let crypto = require("common/crypto");
+
+// EMPTY_HASH is the SHA-256 of an empty payload
+const EMPTY_HASH = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855";
+
+// encode percent-encodes a URI component as SigV4 wants it: everything but
+// unreserved characters, with hex digits in upper case
+let encode = function (s) {
+    return encodeURIComponent(s).replace(/[!'()*]/g, function (c) {
+        return "%" + c.charCodeAt(0).toString(16).toUpperCase();
+    });
+};
+
+// decode undoes the percent-encoding of a URL part, leaving malformed escapes
+// as they are
+let decode = function (s) {
+    try {
+        return decodeURIComponent(s.replace(/\+/g, "%20"));
+    } catch (e) {
+        return s;
+    }
+};
+
+// canonicalUri returns the path of a URL with each segment encoded once, as
+// S3 expects
+let canonicalUri = function (path) {
+    return (path || "/").split("/").map(function (segment) {
+        return encode(decode(segment));
+    }).join("/");
+};
+
+// canonicalQuery returns the query of a URL with its parameters encoded and
+// sorted by name, then value; a parameter without value, such as ?cors, gets
+// an empty one
+let canonicalQuery = function (query) {
+    if (!query) {
+        return "";
+    }
+    return query.split("&").filter(Boolean).map(function (param) {
+        let i = param.indexOf("=");
+        let name = i < 0 ? param : param.substring(0, i);
+        let value = i < 0 ? "" : param.substring(i + 1);
+        return [encode(decode(name)), encode(decode(value))];
+    }).sort(function (a, b) {
+        return a[0] < b[0] ? -1 : a[0] > b[0] ? 1 : a[1] < b[1] ? -1 : a[1] > b[1] ? 1 : 0;
+    }).map(function (param) {
+        return param[0] + "=" + param[1];
+    }).join("&");
+};
+
+// amzDate returns a date in SigV4's basic ISO 8601 form, e.g. 20130524T000000Z
+let amzDate = function (date) {
+    return date.toISOString().replace(/[-:]/g, "").replace(/\.\d+/, "");
+};
+
+// sign returns the headers that authenticate a request with SigV4: the
+// request's own headers plus x-amz-date, x-amz-content-sha256 for S3 and
+// Authorization. All headers passed in are signed, so the request must send
+// them as given; Host is signed from the URL and left for the runtime to
+// send. opts holds:
+//
+//   access-key  the access key ID
+//   secret-key  the secret access key
+//   region      the signing region, e.g. "auto" for R2 or "nyc3" for Spaces
+//   service     the signing service, "s3" for object storage
+//   date        optional time of the request, now by default
+let sign = function (method, url, headers, body, opts) {
+    let match = /^https?:\/\/([^\/?#]+)([^?#]*)(?:\?([^#]*))?/.exec(url);
+    if (!match) {
+        throw new Error("can't sign a request to " + url);
+    }
+    let time = amzDate(opts["date"] || new Date());
+    let day = time.substring(0, 8);
+    let payloadHash = body ? crypto.toHex(crypto.sha256(body)) : EMPTY_HASH;
+
+    let out = Object.assign({}, headers);
+    out["X-Amz-Date"] = time;
+    if (opts["service"] === "s3") {
+        out["X-Amz-Content-Sha256"] = payloadHash;
+    }
+
+    let canonical = {"host": match[1]};
+    for (let name in out) {
+        canonical[name.toLowerCase()] = String(out[name]).trim().replace(/\s+/g, " ");
+    }
+    let names = Object.keys(canonical).sort();
+    let signedHeaders = names.join(";");
+    let request = [
+        method.toUpperCase(),
+        canonicalUri(match[2]),
+        canonicalQuery(match[3]),
+        names.map(function (name) {
+            return name + ":" + canonical[name] + "\n";
+        }).join(""),
+        signedHeaders,
+        payloadHash
+    ].join("\n");
+
+    let scope = day + "/" + opts["region"] + "/" + opts["service"] + "/aws4_request";
+    let stringToSign = ["AWS4-HMAC-SHA256", time, scope, crypto.toHex(crypto.sha256(request))].join("\n");
+    let key = crypto.hmacSha256("AWS4" + opts["secret-key"], day);
+    key = crypto.hmacSha256(key, opts["region"]);
+    key = crypto.hmacSha256(key, opts["service"]);
+    key = crypto.hmacSha256(key, "aws4_request");
+    let signature = crypto.toHex(crypto.hmacSha256(key, stringToSign));
+
+    out["Authorization"] = "AWS4-HMAC-SHA256 Credential=" + opts["access-key"] + "/" + scope +
+        ", SignedHeaders=" + signedHeaders + ", Signature=" + signature;
+    return out;
+};
+
+exports.EMPTY_HASH = EMPTY_HASH;
+exports.encode = encode;
+exports.sign = sign;
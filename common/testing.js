@@ -0,0 +1,180 @@
+// testing runs entity modules and sync scripts under node, in a stand-in for
+// the Monk JavaScript runtime. A test file calls runtime() for a fresh
+// runtime, loads what it tests and registers its cases with test():
+//
+//     node common/crypto_test.js
+//
+// Modules resolve by namespace and name, so "github/sealed-box" loads
+// github/sealed-box.js. HTTP requests go to the runtime's handler instead of
+// the network, which plays the provider API.
+const assert = require("assert");
+const fs = require("fs");
+const path = require("path");
+const vm = require("vm");
+
+const ROOT = path.join(__dirname, "..");
+const ALPHANUMERIC = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789";
+
+// unescapeXml undoes the escaping of XML text, as the runtime's parser does
+let unescapeXml = function (text) {
+    return text.replace(/&(lt|gt|quot|apos|amp);/g, function (m, name) {
+        return {"lt": "<", "gt": ">", "quot": "\"", "apos": "'", "amp": "&"}[name];
+    });
+};
+
+// xmlquery covers the element paths the entities use, e.g. //Error/Message
+let xmlquery = function (body, query) {
+    let names = query.split("/").filter(Boolean);
+    let leaf = names[names.length - 1];
+    let parent = names[names.length - 2];
+    let scopes = parent ? (body || "").match(new RegExp("<" + parent + "[ >][\\s\\S]*?</" + parent + ">", "g")) || [] : [body || ""];
+    let out = [];
+    scopes.forEach(function (scope) {
+        let re = new RegExp("<" + leaf + "(?: [^>]*)?>([\\s\\S]*?)</" + leaf + ">", "g");
+        let m;
+        while ((m = re.exec(scope)) !== null) {
+            out.push(unescapeXml(m[1]));
+        }
+    });
+    return out;
+};
+
+let runtime = function () {
+    let rt = {
+        secrets: {},
+        output: [],
+        requests: [],
+        modules: {},
+        // handler answers requests, by default with an empty 200 response
+        handler: function () {
+            return {"statusCode": 200, "body": ""};
+        }
+    };
+
+    let send = function (method, url, opts) {
+        opts = opts || {};
+        let req = {
+            "method": (opts.method || method).toUpperCase(),
+            "url": url,
+            "headers": opts.headers || {},
+            "body": opts.body,
+            "timeout": opts.timeout
+        };
+        rt.requests.push(req);
+        let res = Object.assign({"statusCode": 200, "body": "", "headers": {}}, rt.handler(req));
+        if (res.statusCode >= 400 && !res.error) {
+            res.error = "response code " + res.statusCode;
+        }
+        return res;
+    };
+    let client = {};
+    ["get", "post", "put", "patch", "delete", "do"].forEach(function (method) {
+        client[method] = function (url, opts) {
+            return send(method === "do" ? "get" : method, url, opts);
+        };
+    });
+
+    rt.modules["cli"] = {
+        "output": function (message) {
+            rt.output.push(String(message));
+        }
+    };
+    rt.modules["http"] = client;
+    ["cloud/aws", "cloud/azure", "cloud/gcp", "cloud/digitalocean"].forEach(function (name) {
+        rt.modules[name] = client;
+    });
+    rt.modules["parser"] = {"xmlquery": xmlquery};
+    rt.modules["secret"] = {
+        "get": function (name) {
+            if (!(name in rt.secrets)) {
+                throw new Error("secret " + name + " not found");
+            }
+            return rt.secrets[name];
+        },
+        "set": function (name, value) {
+            rt.secrets[name] = value;
+        },
+        "remove": function (name) {
+            delete rt.secrets[name];
+        },
+        "randString": function (n) {
+            let out = "";
+            for (let i = 0; i < n; i++) {
+                out += ALPHANUMERIC[Math.floor(Math.random() * ALPHANUMERIC.length)];
+            }
+            return out;
+        }
+    };
+
+    let run = function (file, exports) {
+        let context = {
+            "require": rt.require,
+            "exports": exports,
+            "btoa": function (s) {
+                return Buffer.from(s, "binary").toString("base64");
+            },
+            "console": console
+        };
+        vm.createContext(context);
+        vm.runInContext(fs.readFileSync(file, "utf8"), context, {"filename": file});
+        return context;
+    };
+
+    rt.require = function (name) {
+        if (!(name in rt.modules)) {
+            let exports = {};
+            rt.modules[name] = exports;
+            run(path.join(ROOT, name + ".js"), exports);
+        }
+        return rt.modules[name];
+    };
+
+    // script loads a sync script, relative to the repository root, and
+    // returns its main function
+    rt.script = function (file) {
+        return run(path.join(ROOT, file), {}).main;
+    };
+
+    return rt;
+};
+
+// plain copies values made in the runtime's context, whose arrays and objects
+// have prototypes of their own, so deepStrictEqual compares just their content
+let plain = function (value) {
+    return value === undefined ? value : JSON.parse(JSON.stringify(value));
+};
+
+let checks = Object.assign({}, assert, {
+    "deepStrictEqual": function (actual, expected, message) {
+        assert.deepStrictEqual(plain(actual), plain(expected), message);
+    },
+    "notDeepStrictEqual": function (actual, expected, message) {
+        assert.notDeepStrictEqual(plain(actual), plain(expected), message);
+    }
+});
+
+let cases = [];
+
+let test = function (name, fn) {
+    cases.push({"name": name, "fn": fn});
+};
+
+process.on("beforeExit", function () {
+    let failed = 0;
+    cases.splice(0).forEach(function (c) {
+        try {
+            c.fn();
+            console.log("ok   " + c.name);
+        } catch (e) {
+            failed++;
+            console.log("FAIL " + c.name + "\n" + e.stack);
+        }
+    });
+    if (failed > 0) {
+        process.exitCode = 1;
+    }
+});
+
+exports.runtime = runtime;
+exports.test = test;
+exports.assert = checks;
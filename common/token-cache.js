@@ -0,0 +1,73 @@
+// Caching of the short-lived tokens some providers mint from longer-lived
+// credentials, e.g. with an OAuth client credentials grant, so an action
+// mints one token instead of one per request.
+let secret = require("secret");
+
+// MARGIN is how long before its expiry a cached token is replaced, in
+// milliseconds
+const MARGIN = 60000;
+
+// tokenCache returns the cache of a provider's tokens. config holds:
+//
+//   key           function of the definition returning the credential set a
+//                 token belongs to, e.g. the domain and client ID
+//   getAuthToken  function of the definition minting a token and returning
+//                 {"token": t, "expires-in": seconds}
+//   margin        optional time before expiry to mint a new token, MARGIN by
+//                 default
+//
+// Tokens are kept for the action. When a definition sets token-cache-secret,
+// they are also kept in that Monk secret and shared across actions and
+// entities with the same credentials.
+let tokenCache = function (config) {
+    let margin = config.margin === undefined ? MARGIN : config.margin;
+    let tokens = {};
+
+    let readSecret = function (def) {
+        if (!def["token-cache-secret"]) {
+            return null;
+        }
+        try {
+            return JSON.parse(secret.get(def["token-cache-secret"]));
+        } catch (e) {
+            return null;
+        }
+    };
+
+    // token returns a token for the definition's credentials, minting one
+    // when there is no cached one valid for longer than the margin
+    let token = function (def) {
+        let key = config.key(def);
+        let now = Date.now();
+        let cached = tokens[key] || readSecret(def);
+        if (cached && cached["key"] === key && cached["expires-at"] - margin > now) {
+            tokens[key] = cached;
+            return cached["token"];
+        }
+        let minted = config.getAuthToken(def);
+        let entry = {"key": key, "token": minted["token"], "expires-at": now + minted["expires-in"] * 1000};
+        tokens[key] = entry;
+        if (def["token-cache-secret"]) {
+            secret.set(def["token-cache-secret"], JSON.stringify(entry));
+        }
+        return entry["token"];
+    };
+
+    // invalidate drops the cached token of the definition's credentials, e.g.
+    // after the provider rejected it
+    let invalidate = function (def) {
+        delete tokens[config.key(def)];
+        if (def["token-cache-secret"]) {
+            try {
+                secret.remove(def["token-cache-secret"]);
+            } catch (e) {
+                // nothing cached
+            }
+        }
+    };
+
+    return {"token": token, "invalidate": invalidate};
+};
+
+exports.MARGIN = MARGIN;
+exports.tokenCache = tokenCache;
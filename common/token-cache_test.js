@@ -0,0 +1,66 @@
+// Tests for common/token-cache: node common/token-cache_test.js
+const testing = require("./testing");
+const assert = testing.assert;
+const test = testing.test;
+
+let setup = function (margin) {
+    let rt = testing.runtime();
+    let minted = [];
+    let cache = rt.require("common/token-cache").tokenCache({
+        "key": function (def) {
+            return def["client-id"];
+        },
+        "getAuthToken": function (def) {
+            minted.push(def["client-id"]);
+            return {"token": def["client-id"] + "-" + minted.length, "expires-in": def["expires-in"] || 3600};
+        },
+        "margin": margin
+    });
+    return {"rt": rt, "cache": cache, "minted": minted};
+};
+
+test("a token is minted once for each credential set", function () {
+    let t = setup();
+    assert.strictEqual(t.cache.token({"client-id": "a"}), "a-1");
+    assert.strictEqual(t.cache.token({"client-id": "a"}), "a-1");
+    assert.strictEqual(t.cache.token({"client-id": "b"}), "b-2");
+    assert.deepStrictEqual(t.minted, ["a", "b"]);
+});
+
+test("a token is refreshed once within the margin of its expiry", function () {
+    let t = setup(10000);
+    assert.strictEqual(t.cache.token({"client-id": "a", "expires-in": 5}), "a-1");
+    assert.strictEqual(t.cache.token({"client-id": "a", "expires-in": 3600}), "a-2");
+    assert.strictEqual(t.cache.token({"client-id": "a"}), "a-2");
+    t.cache.invalidate({"client-id": "a"});
+    assert.strictEqual(t.cache.token({"client-id": "a"}), "a-3");
+});
+
+test("token-cache-secret shares tokens of the same credentials", function () {
+    let t = setup();
+    t.cache.token({"client-id": "a", "token-cache-secret": "cache"});
+    let other = setup();
+    other.rt.secrets = t.rt.secrets;
+    assert.strictEqual(other.cache.token({"client-id": "a", "token-cache-secret": "cache"}), "a-1");
+    assert.strictEqual(other.cache.token({"client-id": "b", "token-cache-secret": "cache"}), "b-1");
+    assert.deepStrictEqual(other.minted, ["b"]);
+});
+
+test("auth0/common mints one Management API token for its requests", function () {
+    let rt = testing.runtime();
+    rt.secrets["auth0-secret"] = "s";
+    rt.handler = function (req) {
+        if (req.url.endsWith("/oauth/token")) {
+            return {"body": "{\"access_token\":\"tok\",\"expires_in\":86400}"};
+        }
+        return {"body": "{}"};
+    };
+    let common = rt.require("auth0/common");
+    let def = {"domain": "t.auth0.com", "management-client-id": "c", "management-client-secret": "auth0-secret"};
+    common.request(def, "get", "/clients");
+    common.request(def, "get", "/connections");
+    assert.deepStrictEqual(rt.requests.map(function (r) {
+        return r.url;
+    }), ["https://t.auth0.com/oauth/token", "https://t.auth0.com/api/v2/clients", "https://t.auth0.com/api/v2/connections"]);
+    assert.strictEqual(rt.requests[2].headers["Authorization"], "Bearer tok");
+});
@@ -0,0 +1,122 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+
+let topicsPath = function (def) {
+    return def["rest-endpoint"].replace(/\/+$/, "") + "/kafka/v3/clusters/" + def["cluster-id"] + "/topics";
+};
+
+let request = function (def, method, url, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "Authorization": "Basic " + btoa(def["api-key"] + ":" + secret.get(def["api-secret-secret"])),
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do(url, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).message;
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+let configList = function (configs) {
+    let list = [];
+    for (let name in configs) {
+        list.push({"name": name, "value": String(configs[name])});
+    }
+    return list;
+};
+
+let partitions = function (def) {
+    return def["partitions"] || 6;
+};
+
+let getTopic = function (def) {
+    try {
+        return request(def, "get", topicsPath(def) + "/" + def["name"]);
+    } catch (e) {
+        if (e.message.includes("response code 404")) {
+            return null;
+        }
+        throw e;
+    }
+};
+
+let createTopic = function (def) {
+    let topic = getTopic(def);
+    if (topic) {
+        cli.output("Topic " + def["name"] + " already exists, updating it");
+        return updateTopic(def);
+    }
+    request(def, "post", topicsPath(def), {
+        "topic_name": def["name"],
+        "partitions_count": partitions(def),
+        "replication_factor": def["replication-factor"] || 3,
+        "configs": configList(def["configs"])
+    });
+    return {"cluster-id": def["cluster-id"], "name": def["name"], "partitions": partitions(def)};
+};
+
+// updateTopic grows the partition count if needed and alters the configs
+// whose value differs from the cluster's. Kafka can't remove partitions, so
+// a lower count is rejected rather than ignored.
+let updateTopic = function (def) {
+    let topic = request(def, "get", topicsPath(def) + "/" + def["name"]);
+    let desired = partitions(def);
+    if (desired < topic.partitions_count) {
+        throw new Error("topic " + def["name"] + " has " + topic.partitions_count +
+            " partitions, the partition count can't be decreased to " + desired);
+    }
+    if (desired > topic.partitions_count) {
+        request(def, "patch", topicsPath(def) + "/" + def["name"], {"partitions_count": desired});
+        cli.output("Increased partitions of " + def["name"] + " from " + topic.partitions_count + " to " + desired);
+    }
+
+    let current = {};
+    request(def, "get", topicsPath(def) + "/" + def["name"] + "/configs").data.forEach(function (config) {
+        current[config.name] = config.value;
+    });
+    let changed = configList(def["configs"]).filter(function (config) {
+        return current[config.name] !== config.value;
+    });
+    if (changed.length > 0) {
+        request(def, "post", topicsPath(def) + "/" + def["name"] + "/configs:alter", {"data": changed});
+    }
+    return {"cluster-id": def["cluster-id"], "name": def["name"], "partitions": desired};
+};
+
+let deleteTopic = function (def) {
+    try {
+        request(def, "delete", topicsPath(def) + "/" + def["name"]);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createTopic(def);
+        case "update":
+            return updateTopic(def);
+        case "purge":
+            deleteTopic(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,136 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+
+const MONITOR_TYPES = ["metric alert", "query alert", "service check"];
+
+let baseUrl = function (def) {
+    return "https://api." + (def["site"] || "datadoghq.com") + "/api/v1";
+};
+
+let request = function (def, method, path, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "DD-API-KEY": secret.get(def["api-key-secret"]),
+            "DD-APPLICATION-KEY": secret.get(def["app-key-secret"]),
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do(baseUrl(def) + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).errors.join("; ");
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+let monitorData = function (def) {
+    if (!MONITOR_TYPES.includes(def["type"])) {
+        throw new Error("unsupported monitor type " + def["type"] + ", expected one of " + MONITOR_TYPES.join(", "));
+    }
+    let options = {
+        "notify_no_data": !!def["notify-no-data"]
+    };
+    if (def["thresholds"]) {
+        options["thresholds"] = def["thresholds"];
+    }
+    if (def["renotify-interval"]) {
+        options["renotify_interval"] = def["renotify-interval"];
+    }
+    let data = {
+        "name": def["name"],
+        "type": def["type"],
+        "query": def["query"],
+        "message": def["message"],
+        "tags": def["tags"] || [],
+        "options": options
+    };
+    if (def["priority"]) {
+        data["priority"] = def["priority"];
+    }
+    return data;
+};
+
+// changedFields returns the top-level fields of desired that differ from the
+// current monitor; options are compared key by key so defaults Datadog adds
+// to them don't count as changes
+let changedFields = function (current, desired) {
+    let changes = {};
+    for (let key in desired) {
+        if (key === "options") {
+            let options = {};
+            for (let opt in desired.options) {
+                if (JSON.stringify((current.options || {})[opt]) !== JSON.stringify(desired.options[opt])) {
+                    options[opt] = desired.options[opt];
+                }
+            }
+            if (Object.keys(options).length > 0) {
+                changes.options = options;
+            }
+        } else if (JSON.stringify(current[key]) !== JSON.stringify(desired[key])) {
+            changes[key] = desired[key];
+        }
+    }
+    return changes;
+};
+
+let updateMonitor = function (def, id) {
+    let current = request(def, "get", "/monitor/" + id);
+    let changes = changedFields(current, monitorData(def));
+    if (Object.keys(changes).length === 0) {
+        cli.output("Monitor " + id + " is up to date");
+        return current;
+    }
+    cli.output("Updating monitor " + id + " fields: " + Object.keys(changes).join(", "));
+    return request(def, "put", "/monitor/" + id, changes);
+};
+
+let deleteMonitor = function (def, id) {
+    try {
+        request(def, "delete", "/monitor/" + id);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    let monitor = {};
+    switch (ctx.action) {
+        case "create":
+            monitor = request(def, "post", "/monitor", monitorData(def));
+            break;
+        case "update":
+            if (!state.id) {
+                monitor = request(def, "post", "/monitor", monitorData(def));
+                break;
+            }
+            monitor = updateMonitor(def, state.id);
+            break;
+        case "purge":
+            if (state.id) {
+                deleteMonitor(def, state.id);
+            }
+            return;
+        case "check-readiness":
+            request(def, "get", "/monitor/" + state.id);
+            return state;
+        default:
+            // no action defined
+            return;
+    }
+    return {
+        "id": monitor.id,
+        "url": "https://app." + (def["site"] || "datadoghq.com") + "/monitors/" + monitor.id
+    };
+}
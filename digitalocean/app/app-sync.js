@@ -0,0 +1,181 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+let api = require("common/api");
+
+const BASE_URL = "https://api.digitalocean.com/v2";
+
+// DEPLOYMENT_WAIT is how check-readiness waits for a deployment to finish,
+// up to the 20 minutes Monk used to retry the check for
+const DEPLOYMENT_WAIT = {"interval": 5000, "max-interval": 15000, "timeout": 20 * 60 * 1000};
+
+// SPEC_DEPLOYMENT_WAIT is how long an update waits for the deployment its
+// spec change starts to show up before starting one itself
+const SPEC_DEPLOYMENT_WAIT = {"interval": 2000, "max-interval": 5000, "timeout": 30 * 1000};
+
+// FAILED_PHASES are the phases a deployment ends in without going live
+const FAILED_PHASES = ["ERROR", "CANCELED"];
+
+let request = function (def, method, path, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "Authorization": "Bearer " + secret.get(def["token-secret"]),
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do(BASE_URL + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).message;
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+// appSpec returns the spec from the definition with the values of
+// secret-envs added as encrypted app-wide variables
+let appSpec = function (def) {
+    let spec = JSON.parse(JSON.stringify(def["spec"]));
+    if (!spec["name"]) {
+        throw new Error("spec.name is required");
+    }
+    let envs = (spec["envs"] || []).filter(function (env) {
+        return !(def["secret-envs"] || {})[env.key];
+    });
+    Object.keys(def["secret-envs"] || {}).forEach(function (key) {
+        envs.push({"key": key, "value": secret.get(def["secret-envs"][key]), "type": "SECRET", "scope": "RUN_AND_BUILD_TIME"});
+    });
+    if (envs.length > 0) {
+        spec["envs"] = envs;
+    }
+    return spec;
+};
+
+let latestDeployment = function (def, id) {
+    let deployments = request(def, "get", "/apps/" + id + "/deployments?page=1&per_page=1").deployments || [];
+    return deployments.length > 0 ? deployments[0] : null;
+};
+
+let createApp = function (def) {
+    let app = request(def, "post", "/apps", {"spec": appSpec(def)}).app;
+    cli.output("Created app " + app.spec.name + " (" + app.id + ")");
+    let deployment = latestDeployment(def, app.id);
+    return {"id": app.id, "name": app.spec.name, "deployment-id": deployment ? deployment.id : "", "phase": ""};
+};
+
+// newDeployment waits for a deployment of the app other than previous to
+// show up, as submitting a changed spec starts one a moment later, and
+// returns it, or null when none does
+let newDeployment = function (def, id, previous) {
+    let deployment = null;
+    try {
+        api.waitFor(function () {
+            let latest = latestDeployment(def, id);
+            if (latest && latest.id !== previous) {
+                deployment = latest;
+                return true;
+            }
+            return "no new deployment";
+        }, Object.assign({"what": "a deployment of the new spec"}, SPEC_DEPLOYMENT_WAIT));
+    } catch (e) {
+        if (!e.message.startsWith("timed out")) {
+            throw e;
+        }
+    }
+    return deployment;
+};
+
+// updateApp submits the spec and picks up the deployment it started,
+// starting one only when the spec change didn't, e.g. for an unchanged spec
+let updateApp = function (def, state) {
+    let app = request(def, "put", "/apps/" + state["id"], {"spec": appSpec(def)}).app;
+    let deployment = newDeployment(def, app.id, state["deployment-id"]);
+    if (!deployment) {
+        deployment = request(def, "post", "/apps/" + app.id + "/deployments", {"force_build": false}).deployment;
+    }
+    cli.output("Deploying " + app.spec.name + " (" + deployment.id + ")");
+    return Object.assign({}, state, {"name": app.spec.name, "deployment-id": deployment.id, "phase": deployment.phase});
+};
+
+// deploymentDone returns true for an active deployment, throws for one that
+// ended in ERROR or CANCELED, which will never go live, and returns the
+// phase of one still running
+let deploymentDone = function (deployment, name) {
+    if (deployment.phase === "ACTIVE") {
+        return true;
+    }
+    if (FAILED_PHASES.includes(deployment.phase)) {
+        let steps = ((deployment.progress || {}).steps || []).filter(function (step) {
+            return step.status === "ERROR";
+        }).map(function (step) {
+            return step.name + (step.reason ? ": " + step.reason.message : "");
+        });
+        throw new Error("deployment " + deployment.id + " of " + name + " ended in " + deployment.phase +
+            (steps.length > 0 ? ", failed steps: " + steps.join("; ") : ""));
+    }
+    return deployment.phase;
+};
+
+// checkReadiness waits for the deployment to go live itself rather than
+// leaving the retries to Monk, so that a failed deployment fails the check
+// at once instead of after every remaining attempt
+let checkReadiness = function (def, state) {
+    let deploymentId = state["deployment-id"];
+    if (!deploymentId) {
+        let latest = latestDeployment(def, state["id"]);
+        if (!latest) {
+            throw new Error("app " + state["name"] + " has no deployment yet");
+        }
+        deploymentId = latest.id;
+    }
+    let deployment;
+    api.waitFor(function () {
+        deployment = request(def, "get", "/apps/" + state["id"] + "/deployments/" + deploymentId).deployment;
+        return deploymentDone(deployment, state["name"]);
+    }, Object.assign({"what": "deployment " + deploymentId + " of " + state["name"]}, DEPLOYMENT_WAIT));
+    let app = request(def, "get", "/apps/" + state["id"]).app;
+    return Object.assign({}, state, {
+        "deployment-id": deploymentId,
+        "phase": deployment.phase,
+        "live-url": app.live_url,
+        "default-ingress": app.default_ingress
+    });
+};
+
+let deleteApp = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    try {
+        request(def, "delete", "/apps/" + state["id"]);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createApp(def);
+        case "update":
+            return updateApp(def, state);
+        case "check-readiness":
+            return checkReadiness(def, state);
+        case "purge":
+            deleteApp(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,67 @@
+let cli = require("cli");
+let s3 = require("common/s3");
+
+const ACLS = ["private", "public-read"];
+
+// spaces talks to the S3-compatible endpoint of the bucket's region, which is
+// also the signing region
+let spaces = s3.client({
+    "name": "DigitalOcean Spaces",
+    "endpoint": function (def) {
+        return "https://" + def["region"] + ".digitaloceanspaces.com";
+    },
+    "region": function (def) {
+        return def["region"];
+    }
+});
+
+let acl = function (def) {
+    let value = def["acl"] || "private";
+    if (!ACLS.includes(value)) {
+        throw new Error("acl must be one of " + ACLS.join(", ") + ", not " + value);
+    }
+    return value;
+};
+
+let bucketState = function (def) {
+    return {
+        "name": def["name"],
+        "region": def["region"],
+        "endpoint": "https://" + def["name"] + "." + def["region"] + ".digitaloceanspaces.com"
+    };
+};
+
+let createBucket = function (def) {
+    if (spaces.exists(def, def["name"])) {
+        cli.output("Bucket " + def["name"] + " already exists");
+        spaces.setAcl(def, def["name"], acl(def));
+    } else {
+        spaces.createBucket(def, def["name"], {"acl": acl(def)});
+        cli.output("Created bucket " + def["name"] + " in " + def["region"]);
+    }
+    spaces.setCors(def, def["name"], def["cors-rules"]);
+    return bucketState(def);
+};
+
+// updateBucket applies the definition's ACL and replaces the bucket's CORS
+// rules, removing them when none are set
+let updateBucket = function (def) {
+    spaces.setAcl(def, def["name"], acl(def));
+    spaces.setCors(def, def["name"], def["cors-rules"]);
+    return bucketState(def);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createBucket(def);
+        case "update":
+            return updateBucket(def);
+        case "purge":
+            spaces.deleteBucket(def, def["name"], def["force-delete"]);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,164 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+
+const BASE_URL = "https://api.elastic-cloud.com/api/v1";
+
+let request = function (def, method, path, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "Authorization": "ApiKey " + secret.get(def["api-key-secret"]),
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do(BASE_URL + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).errors.map(function (error) {
+                return error.message + " (" + error.code + ")";
+            }).join("; ");
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+// applyTopology sets the version and sizes from the definition on an
+// Elasticsearch or Kibana plan and reports whether anything changed
+let applyTopology = function (def, kind, plan) {
+    let before = JSON.stringify(plan);
+    plan[kind] = plan[kind] || {};
+    plan[kind]["version"] = def["version"];
+    if (kind === "elasticsearch") {
+        (def["topology"] || []).forEach(function (tier) {
+            let element = (plan["cluster_topology"] || []).find(function (e) {
+                return e.id === tier["id"];
+            });
+            if (!element) {
+                throw new Error("template " + def["template"] + " has no " + tier["id"] + " tier");
+            }
+            if (tier["size"] !== undefined) {
+                element["size"] = {"resource": "memory", "value": tier["size"]};
+            }
+            if (tier["zones"] !== undefined) {
+                element["zone_count"] = tier["zones"];
+            }
+        });
+    } else if (def["kibana-size"] && plan["cluster_topology"] && plan["cluster_topology"].length > 0) {
+        plan["cluster_topology"][0]["size"] = {"resource": "memory", "value": def["kibana-size"]};
+    }
+    return JSON.stringify(plan) !== before;
+};
+
+let createDeployment = function (def) {
+    let template = request(def, "get", "/deployments/templates/" + def["template"] + "?region=" + def["region"]);
+    let body = template.deployment_template;
+    body["name"] = def["name"];
+    ["elasticsearch", "kibana"].forEach(function (kind) {
+        (body.resources[kind] || []).forEach(function (resource) {
+            applyTopology(def, kind, resource.plan);
+        });
+    });
+
+    let deployment = request(def, "post", "/deployments", body);
+    deployment.resources.forEach(function (resource) {
+        if (resource.kind === "elasticsearch" && resource.credentials) {
+            secret.set(def["password-secret"], resource.credentials.password);
+        }
+    });
+    cli.output("Created deployment " + deployment.id);
+    return {"id": deployment.id, "name": deployment.name, "username": "elastic", "ready": false};
+};
+
+let updateDeployment = function (def, state) {
+    let deployment = request(def, "get", "/deployments/" + state["id"] + "?show_plans=true");
+    let resources = {};
+    ["elasticsearch", "kibana"].forEach(function (kind) {
+        (deployment.resources[kind] || []).forEach(function (resource) {
+            let plan = resource.info.plan_info.current.plan;
+            if (applyTopology(def, kind, plan)) {
+                resources[kind] = resources[kind] || [];
+                resources[kind].push({"region": resource.region, "ref_id": resource.ref_id, "plan": plan});
+            }
+        });
+    });
+    if (Object.keys(resources).length === 0 && deployment.name === def["name"]) {
+        return state;
+    }
+
+    cli.output("Updating " + (Object.keys(resources).join(", ") || "name") + " of deployment " + state["id"]);
+    request(def, "put", "/deployments/" + state["id"], {
+        "name": def["name"],
+        "prune_orphans": false,
+        "resources": resources
+    });
+    return Object.assign({}, state, {"name": def["name"], "ready": false});
+};
+
+// checkReadiness waits for every resource of the deployment to be started
+// with no plan change pending, then records the endpoints
+let checkReadiness = function (def, state) {
+    let deployment = request(def, "get", "/deployments/" + state["id"]);
+    let result = Object.assign({}, state, {"ready": true});
+    Object.keys(deployment.resources).forEach(function (kind) {
+        deployment.resources[kind].forEach(function (resource) {
+            if (resource.info.status !== "started" || resource.info.plan_info.pending) {
+                throw new Error(kind + " of deployment " + state["id"] + " is " + resource.info.status +
+                    (resource.info.plan_info.pending ? ", plan change pending" : ""));
+            }
+            let url = (resource.info.metadata || {}).service_url;
+            if (kind === "elasticsearch") {
+                result["elasticsearch-url"] = url;
+                result["cloud-id"] = resource.info.metadata.cloud_id;
+            } else if (kind === "kibana") {
+                result["kibana-url"] = url;
+            }
+        });
+    });
+    return result;
+};
+
+// deleteDeployment shuts the deployment down before deleting it, a running
+// deployment can't be deleted
+let deleteDeployment = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    try {
+        request(def, "post", "/deployments/" + state["id"] + "/_shutdown");
+        request(def, "delete", "/deployments/" + state["id"]);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+    try {
+        secret.remove(def["password-secret"]);
+    } catch (error) {
+        cli.output("Secret not found");
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createDeployment(def);
+        case "update":
+            return updateDeployment(def, state);
+        case "check-readiness":
+            return checkReadiness(def, state);
+        case "purge":
+            deleteDeployment(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
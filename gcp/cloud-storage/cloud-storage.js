@@ -2,6 +2,8 @@ let gcp = require("cloud/gcp");
 let cli = require("cli");
 let http = require("http");
 
+let BASE_URL = "https://storage.googleapis.com/storage/v1";
+
 function encodeQueryData(data) {
     const ret = [];
     for (let d in data)
@@ -9,28 +11,52 @@ function encodeQueryData(data) {
     return ret.join('&');
  }
 
+// bucketSettings maps the definition to the mutable bucket fields, so create
+// and update send the same configuration
+let bucketSettings = function (def) {
+    let data = {
+        "labels": Object.assign({}, def["labels"]),
+        "lifecycle": {
+            "rule": def["lifecycle-rules"] || []
+        }
+    };
+    if (def["storage-class"]) {
+        data["storageClass"] = def["storage-class"];
+    }
+    if (def["uniform-bucket-level-access"] !== undefined) {
+        data["iamConfiguration"] = {
+            "uniformBucketLevelAccess": {
+                "enabled": def["uniform-bucket-level-access"]
+            }
+        };
+    }
+    return data;
+};
+
 let createBucket = function (def) {
     cli.output("createBucket");
 
     let urlParam = {
-        "project": gcp.getProject(),
+        "project": def["project"] || gcp.getProject(),
         "alt": "json"
     };
     if (def["predefined-acl"]) {
-        param["predefinedAcl"] = def["predefined-acl"];
+        urlParam["predefinedAcl"] = def["predefined-acl"];
     }
     if (def["predefined-default-object-acl"]) {
-        param["predefinedDefaultObjectAcl"] = def["predefined-default-object-acl"];
+        urlParam["predefinedDefaultObjectAcl"] = def["predefined-default-object-acl"];
     }
     if (def["projection"]) {
-        param["projection"] = def["projection"];
+        urlParam["projection"] = def["projection"];
     }
 
-    let data = {
-        "name": def["name"]
-    };
-    cli.output("https://storage.googleapis.com/storage/v1/b?" + encodeQueryData(urlParam))
-    let res = gcp.post("https://storage.googleapis.com/storage/v1/b?" + encodeQueryData(urlParam), {
+    let data = bucketSettings(def);
+    data["name"] = def["name"];
+    if (def["location"]) {
+        data["location"] = def["location"];
+    }
+    cli.output(BASE_URL + "/b?" + encodeQueryData(urlParam))
+    let res = gcp.post(BASE_URL + "/b?" + encodeQueryData(urlParam), {
             "body": JSON.stringify(data),
             "headers": {
                 "Content-Type": "application/json"
@@ -44,9 +70,73 @@ let createBucket = function (def) {
 
 }
 
+// updateBucket reconciles labels, lifecycle rules, storage class and access
+// settings. The location of a bucket can't be changed.
+let updateBucket = function (def) {
+    let current = getBucket(def);
+    let data = bucketSettings(def);
+    // labels missing from the definition have to be removed explicitly
+    for (let key in current.labels || {}) {
+        if (!(key in data.labels)) {
+            data.labels[key] = null;
+        }
+    }
+
+    let res = gcp.post(BASE_URL + "/b/" + def["name"], {
+            "body": JSON.stringify(data),
+            "headers": {
+                "Content-Type": "application/json",
+                "X-HTTP-Method-Override": "PATCH"
+            }
+    });
+    if (res.error) {
+        throw new Error(res.error + ", body " + res.body);
+    }
+    return JSON.parse(res.body)
+}
+
+let listObjects = function (def, pageToken) {
+    let query = {"fields": "items(name),nextPageToken"};
+    if (pageToken) {
+        query["pageToken"] = pageToken;
+    }
+    let res = gcp.get(BASE_URL + "/b/" + def["name"] + "/o?" + encodeQueryData(query));
+    if (res.error) {
+        throw new Error(res.error + ", body " + res.body);
+    }
+    return JSON.parse(res.body)
+}
+
+let emptyBucket = function (def) {
+    let pageToken = "";
+    do {
+        let page = listObjects(def, pageToken);
+        (page.items || []).forEach(function (item) {
+            let res = gcp.delete(BASE_URL + "/b/" + def["name"] + "/o/" + encodeURIComponent(item.name));
+            if (res.error && !res.error.includes("response code 404")) {
+                throw new Error(res.error + ", body " + res.body);
+            }
+        });
+        pageToken = page.nextPageToken;
+    } while (pageToken);
+}
 
 let deleteBucket = function (def) {
-    let res = gcp.delete("https://storage.googleapis.com/storage/v1/b/" + def["name"]);
+    let res = gcp.get(BASE_URL + "/b/" + def["name"]);
+    if (res.error && res.error.includes("response code 404")) {
+        // bucket is already removed
+        return res;
+    }
+
+    if ((listObjects(def).items || []).length > 0) {
+        if (!def["force-delete"]) {
+            throw new Error("bucket " + def["name"] + " is not empty, set force-delete to remove it with its objects");
+        }
+        cli.output("Deleting all objects from " + def["name"]);
+        emptyBucket(def);
+    }
+
+    res = gcp.delete(BASE_URL + "/b/" + def["name"]);
     if (res.error) {
         throw new Error(res.error + ", body " + res.body);
     }
@@ -54,7 +144,7 @@ let deleteBucket = function (def) {
 }
 
 let getBucket = function (def) {
-    let res = gcp.get("https://storage.googleapis.com/storage/v1/b/" + def["name"]);
+    let res = gcp.get(BASE_URL + "/b/" + def["name"]);
     if (res.error) {
         throw new Error(res.error + ", body " + res.body);
     }
@@ -62,20 +152,31 @@ let getBucket = function (def) {
     
 }
 
+let toState = function (bucket) {
+    return {
+        "name": bucket.name,
+        "location": bucket.location,
+        "storage-class": bucket.storageClass,
+        "self-link": bucket.selfLink
+    };
+}
+
 function main(def, state, ctx) {
     cli.output(ctx.action);
     let res = {};
     switch (ctx.action) {
         case "recreate":
         case "create":
-            createBucket(def)
-            break;
+            return toState(createBucket(def));
+        case "update":
+            return toState(updateBucket(def));
         case "purge":
             res = deleteBucket(def);
             state["status"] = "deleted";
             break;
         case "get":
             res = getBucket(def);
+            cli.output(JSON.stringify(res));
             break;
         default:
             // no action defined
@@ -86,4 +187,4 @@ function main(def, state, ctx) {
     }
 
     return state;
-}
\ No newline at end of file
+}
@@ -0,0 +1,84 @@
+let cli = require("cli");
+let secret = require("secret");
+let crypto = require("common/crypto");
+let common = require("github/common");
+let seal = require("github/sealed-box").seal;
+let request = common.request;
+let checkError = common.checkError;
+
+// valueHash hashes the value for the state, keyed with the token so the hash
+// can't be checked against guessed values
+let valueHash = function (def, value) {
+    return crypto.valueHash(secret.get(def["token-secret"]), value);
+};
+
+let secretsPath = function (repository) {
+    if (!repository) {
+        throw new Error("repository is required, set it or connect the secret to a github/repository");
+    }
+    return "/repos/" + repository + "/actions/secrets";
+};
+
+// putSecret encrypts the value with the repository public key and uploads
+// it. The value itself is never written to the output or the state.
+let putSecret = function (def, value) {
+    let key = checkError(request(def, "get", secretsPath(def["repository"]) + "/public-key"));
+    checkError(request(def, "put", secretsPath(def["repository"]) + "/" + def["name"], {
+        "encrypted_value": seal(value, key.key),
+        "key_id": key.key_id
+    }));
+    cli.output("Set Actions secret " + def["name"] + " of " + def["repository"]);
+};
+
+let toState = function (def, hash) {
+    return {"repository": def["repository"], "name": def["name"], "value-hash": hash};
+};
+
+let createSecret = function (def) {
+    let value = secret.get(def["value-secret"]);
+    putSecret(def, value);
+    return toState(def, valueHash(def, value));
+};
+
+// updateSecret only uploads the secret when its repository, name or value
+// hash changed, removing it under the old name after a rename
+let updateSecret = function (def, state) {
+    let value = secret.get(def["value-secret"]);
+    let hash = valueHash(def, value);
+    if (def["repository"] === state["repository"] && def["name"] === state["name"] && hash === state["value-hash"]) {
+        return state;
+    }
+    putSecret(def, value);
+    if (def["repository"] !== state["repository"] || def["name"] !== state["name"]) {
+        deleteSecret(def, state);
+    }
+    return toState(def, hash);
+};
+
+let deleteSecret = function (def, state) {
+    if (!state["name"]) {
+        return;
+    }
+    let res = request(def, "delete", secretsPath(state["repository"]) + "/" + state["name"]);
+    if (res.error && res.error.includes("response code 404")) {
+        // secret is already removed
+        return;
+    }
+    checkError(res);
+    cli.output("Removed Actions secret " + state["name"] + " of " + state["repository"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createSecret(def);
+        case "update":
+            return updateSecret(def, state);
+        case "purge":
+            deleteSecret(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
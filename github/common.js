@@ -0,0 +1,38 @@
+// REST API access shared by the GitHub entities.
+let http = require("http");
+let secret = require("secret");
+
+const BASE_URL = "https://api.github.com";
+
+let request = function (def, method, path, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "Authorization": "Bearer " + secret.get(def["token-secret"]),
+            "Accept": "application/vnd.github+json",
+            "X-GitHub-Api-Version": "2022-11-28",
+            "User-Agent": "monk-entities",
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    return http.do(BASE_URL + path, opts);
+};
+
+let checkError = function (res) {
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).message;
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+exports.request = request;
+exports.checkError = checkError;
@@ -0,0 +1,102 @@
+let cli = require("cli");
+let common = require("github/common");
+let request = common.request;
+let checkError = common.checkError;
+
+let repoPath = function (def) {
+    return "/repos/" + def["owner"] + "/" + def["name"];
+};
+
+let settings = function (def) {
+    return {
+        "description": def["description"] || "",
+        "homepage": def["homepage"] || "",
+        "visibility": def["visibility"] || "private",
+        "has_issues": def["has-issues"] !== false,
+        "has_wiki": !!def["has-wiki"],
+        "has_projects": !!def["has-projects"],
+        "delete_branch_on_merge": !!def["delete-branch-on-merge"]
+    };
+};
+
+let getRepo = function (def) {
+    let res = request(def, "get", repoPath(def));
+    if (res.error && res.error.includes("response code 404")) {
+        return null;
+    }
+    return checkError(res);
+};
+
+let createRepo = function (def) {
+    let body = settings(def);
+    body["name"] = def["name"];
+    body["auto_init"] = !!def["auto-init"];
+
+    // repositories of the authenticated user and of organizations use different endpoints
+    let user = checkError(request(def, "get", "/user"));
+    let path = user.login === def["owner"] ? "/user/repos" : "/orgs/" + def["owner"] + "/repos";
+    return checkError(request(def, "post", path, body));
+};
+
+let updateRepo = function (def) {
+    return checkError(request(def, "patch", repoPath(def), settings(def)));
+};
+
+let setTopics = function (def) {
+    if (!def["topics"]) {
+        return;
+    }
+    checkError(request(def, "put", repoPath(def) + "/topics", {"names": def["topics"]}));
+};
+
+let deleteRepo = function (def) {
+    if (!getRepo(def)) {
+        // repository is already removed
+        return;
+    }
+    if (!def["delete-on-purge"]) {
+        checkError(request(def, "patch", repoPath(def), {"archived": true}));
+        cli.output("Archived repository " + def["owner"] + "/" + def["name"]);
+        return;
+    }
+    checkError(request(def, "delete", repoPath(def)));
+};
+
+let toState = function (repo) {
+    return {
+        "id": repo.id,
+        "full-name": repo.full_name,
+        "html-url": repo.html_url,
+        "clone-url": repo.clone_url,
+        "ssh-url": repo.ssh_url,
+        "default-branch": repo.default_branch,
+        "visibility": repo.visibility
+    };
+};
+
+function main(def, state, ctx) {
+    let repo = {};
+    switch (ctx.action) {
+        case "create":
+            if (getRepo(def)) {
+                // adopt the existing repository
+                cli.output("Repository " + def["owner"] + "/" + def["name"] + " already exists, updating it");
+                repo = updateRepo(def);
+            } else {
+                repo = createRepo(def);
+            }
+            setTopics(def);
+            break;
+        case "update":
+            repo = updateRepo(def);
+            setTopics(def);
+            break;
+        case "purge":
+            deleteRepo(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+    return toState(repo);
+}
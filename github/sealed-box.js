@@ -0,0 +1,327 @@
+// libsodium's crypto_box_seal in plain JavaScript, which GitHub requires for
+// Actions secrets: X25519 for the key exchange, XSalsa20-Poly1305 for the
+// box and BLAKE2b for the nonce. Byte strings are arrays of numbers, as the
+// entity runtime has no crypto primitives of its own. sealed-box_test.js
+// checks it against libsodium and the RFC 7748 vectors.
+let crypto = require("common/crypto");
+let utf8Bytes = crypto.utf8Bytes;
+let zeros = crypto.zeros;
+let blake2b = crypto.blake2b;
+
+// --- Salsa20 and Poly1305
+
+let rotl32 = function (x, n) {
+    return ((x << n) | (x >>> (32 - n))) >>> 0;
+};
+
+let salsaQuarter = function (x, a, b, c, d) {
+    x[b] = (x[b] ^ rotl32((x[a] + x[d]) >>> 0, 7)) >>> 0;
+    x[c] = (x[c] ^ rotl32((x[b] + x[a]) >>> 0, 9)) >>> 0;
+    x[d] = (x[d] ^ rotl32((x[c] + x[b]) >>> 0, 13)) >>> 0;
+    x[a] = (x[a] ^ rotl32((x[d] + x[c]) >>> 0, 18)) >>> 0;
+};
+
+let word = function (bytes, i) {
+    return (bytes[i] | (bytes[i + 1] << 8) | (bytes[i + 2] << 16) | (bytes[i + 3] << 24)) >>> 0;
+};
+
+// "expand 32-byte k"
+const SIGMA = [0x61707865, 0x3320646e, 0x79622d32, 0x6b206574];
+
+// salsaRounds runs the 20 Salsa20 rounds over the state built from a 32 byte
+// key and 16 byte input and returns both the initial and the final state
+let salsaRounds = function (key, input) {
+    let init = [
+        SIGMA[0], word(key, 0), word(key, 4), word(key, 8),
+        word(key, 12), SIGMA[1], word(input, 0), word(input, 4),
+        word(input, 8), word(input, 12), SIGMA[2], word(key, 16),
+        word(key, 20), word(key, 24), word(key, 28), SIGMA[3]
+    ];
+    let x = init.slice();
+    for (let i = 0; i < 10; i++) {
+        salsaQuarter(x, 0, 4, 8, 12);
+        salsaQuarter(x, 5, 9, 13, 1);
+        salsaQuarter(x, 10, 14, 2, 6);
+        salsaQuarter(x, 15, 3, 7, 11);
+        salsaQuarter(x, 0, 1, 2, 3);
+        salsaQuarter(x, 5, 6, 7, 4);
+        salsaQuarter(x, 10, 11, 8, 9);
+        salsaQuarter(x, 15, 12, 13, 14);
+    }
+    return {"init": init, "x": x};
+};
+
+let wordsToBytes = function (words) {
+    let out = [];
+    words.forEach(function (w) {
+        out.push(w & 0xff, (w >>> 8) & 0xff, (w >>> 16) & 0xff, (w >>> 24) & 0xff);
+    });
+    return out;
+};
+
+let hsalsa20 = function (key, input) {
+    let x = salsaRounds(key, input).x;
+    return wordsToBytes([x[0], x[5], x[10], x[15], x[6], x[7], x[8], x[9]]);
+};
+
+// xsalsa20Stream returns length bytes of the XSalsa20 key stream
+let xsalsa20Stream = function (key, nonce, length) {
+    let subkey = hsalsa20(key, nonce.slice(0, 16));
+    let out = [];
+    for (let counter = 0; out.length < length; counter++) {
+        let input = nonce.slice(16, 24).concat(wordsToBytes([counter, 0]));
+        let rounds = salsaRounds(subkey, input);
+        out = out.concat(wordsToBytes(rounds.x.map(function (w, i) {
+            return (w + rounds.init[i]) >>> 0;
+        })));
+    }
+    return out.slice(0, length);
+};
+
+// poly1305Add adds c to h, both 17 byte little-endian numbers
+let poly1305Add = function (h, c) {
+    let u = 0;
+    for (let j = 0; j < 17; j++) {
+        u += h[j] + c[j];
+        h[j] = u & 0xff;
+        u >>>= 8;
+    }
+};
+
+// 2^130 - 5 negated, modulo 2^136
+const POLY1305_MINUS_P = [5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 252];
+
+let poly1305 = function (message, key) {
+    let r = key.slice(0, 16).concat([0]);
+    r[3] &= 15;
+    r[4] &= 252;
+    r[7] &= 15;
+    r[8] &= 252;
+    r[11] &= 15;
+    r[12] &= 252;
+    r[15] &= 15;
+
+    let h = zeros(17);
+    for (let offset = 0; offset < message.length; offset += 16) {
+        let c = message.slice(offset, offset + 16);
+        c.push(1);
+        poly1305Add(h, c.concat(zeros(17 - c.length)));
+
+        // h = h * r, reduced modulo 2^130 - 5 as 2^136 = 320 (mod p)
+        let x = [];
+        for (let i = 0; i < 17; i++) {
+            let sum = 0;
+            for (let j = 0; j < 17; j++) {
+                sum += h[j] * (j <= i ? r[i - j] : 320 * r[i + 17 - j]);
+            }
+            x.push(sum);
+        }
+        let u = 0;
+        for (let j = 0; j < 16; j++) {
+            u += x[j];
+            h[j] = u & 0xff;
+            u = Math.floor(u / 256);
+        }
+        u += x[16];
+        h[16] = u & 3;
+        u = 5 * Math.floor(u / 4);
+        for (let j = 0; j < 16; j++) {
+            u += h[j];
+            h[j] = u & 0xff;
+            u = Math.floor(u / 256);
+        }
+        h[16] += u;
+    }
+
+    // subtract p if h >= p, then add the second half of the key
+    let g = h.slice();
+    poly1305Add(h, POLY1305_MINUS_P);
+    if ((h[16] & 0x80) !== 0) {
+        h = g;
+    }
+    poly1305Add(h, key.slice(16, 32).concat([0]));
+    return h.slice(0, 16);
+};
+
+// --- X25519, with field elements as 16 limbs of 16 bits (after TweetNaCl)
+
+let fe = function (init) {
+    let o = zeros(16);
+    (init || []).forEach(function (v, i) {
+        o[i] = v;
+    });
+    return o;
+};
+
+let carry = function (o) {
+    for (let i = 0; i < 16; i++) {
+        o[i] += 65536;
+        let c = Math.floor(o[i] / 65536);
+        if (i < 15) {
+            o[i + 1] += c - 1;
+        } else {
+            o[0] += 38 * (c - 1);
+        }
+        o[i] -= c * 65536;
+    }
+};
+
+let feAdd = function (o, a, b) {
+    for (let i = 0; i < 16; i++) {
+        o[i] = a[i] + b[i];
+    }
+};
+
+let feSub = function (o, a, b) {
+    for (let i = 0; i < 16; i++) {
+        o[i] = a[i] - b[i];
+    }
+};
+
+let feMul = function (o, a, b) {
+    let t = zeros(31);
+    for (let i = 0; i < 16; i++) {
+        for (let j = 0; j < 16; j++) {
+            t[i + j] += a[i] * b[j];
+        }
+    }
+    for (let i = 0; i < 15; i++) {
+        t[i] += 38 * t[i + 16];
+    }
+    for (let i = 0; i < 16; i++) {
+        o[i] = t[i];
+    }
+    carry(o);
+    carry(o);
+};
+
+// feSwap swaps p and q if b is 1, in constant time
+let feSwap = function (p, q, b) {
+    let mask = -b;
+    for (let i = 0; i < 16; i++) {
+        let t = mask & (p[i] ^ q[i]);
+        p[i] ^= t;
+        q[i] ^= t;
+    }
+};
+
+let feInvert = function (o, a) {
+    let c = a.slice();
+    for (let i = 253; i >= 0; i--) {
+        feMul(c, c, c);
+        if (i !== 2 && i !== 4) {
+            feMul(c, c, a);
+        }
+    }
+    for (let i = 0; i < 16; i++) {
+        o[i] = c[i];
+    }
+};
+
+let feUnpack = function (bytes) {
+    let o = fe();
+    for (let i = 0; i < 16; i++) {
+        o[i] = bytes[2 * i] + (bytes[2 * i + 1] << 8);
+    }
+    o[15] &= 0x7fff;
+    return o;
+};
+
+let fePack = function (n) {
+    let t = n.slice();
+    carry(t);
+    carry(t);
+    carry(t);
+    let m = fe();
+    for (let j = 0; j < 2; j++) {
+        m[0] = t[0] - 0xffed;
+        for (let i = 1; i < 15; i++) {
+            m[i] = t[i] - 0xffff - ((m[i - 1] >> 16) & 1);
+            m[i - 1] &= 0xffff;
+        }
+        m[15] = t[15] - 0x7fff - ((m[14] >> 16) & 1);
+        let b = (m[15] >> 16) & 1;
+        m[14] &= 0xffff;
+        feSwap(t, m, 1 - b);
+    }
+    let out = [];
+    for (let i = 0; i < 16; i++) {
+        out.push(t[i] & 0xff, t[i] >> 8);
+    }
+    return out;
+};
+
+// x25519 multiplies the point with u-coordinate point by scalar
+let x25519 = function (scalar, point) {
+    let z = scalar.slice(0, 32);
+    z[31] = (z[31] & 127) | 64;
+    z[0] &= 248;
+
+    let x = feUnpack(point);
+    let a = fe([1]), b = x.slice(), c = fe(), d = fe([1]), e = fe(), f = fe();
+    const A24 = fe([0xdb41, 1]);
+    for (let i = 254; i >= 0; i--) {
+        let bit = (z[i >>> 3] >>> (i & 7)) & 1;
+        feSwap(a, b, bit);
+        feSwap(c, d, bit);
+        feAdd(e, a, c);
+        feSub(a, a, c);
+        feAdd(c, b, d);
+        feSub(b, b, d);
+        feMul(d, e, e);
+        feMul(f, a, a);
+        feMul(a, c, a);
+        feMul(c, b, e);
+        feAdd(e, a, c);
+        feSub(a, a, c);
+        feMul(b, a, a);
+        feSub(c, d, f);
+        feMul(a, c, A24);
+        feAdd(a, a, d);
+        feMul(c, c, a);
+        feMul(a, d, f);
+        feMul(d, b, x);
+        feMul(b, e, e);
+        feSwap(a, b, bit);
+        feSwap(c, d, bit);
+    }
+    feInvert(c, c);
+    feMul(a, a, c);
+    return fePack(a);
+};
+
+const BASE_POINT = [9].concat(zeros(31));
+
+// sealWithKey encrypts value for the holder of the base64 encoded X25519
+// public key with the given ephemeral secret key, and returns the base64
+// encoded sealed box: the ephemeral public key, the Poly1305 tag and the
+// ciphertext. Only tests pass their own key, to compare against libsodium.
+let sealWithKey = function (value, publicKey, esk) {
+    let pk = crypto.fromBase64(publicKey);
+    if (pk.length !== 32) {
+        throw new Error("public key must be 32 bytes, got " + pk.length);
+    }
+    let epk = x25519(esk, BASE_POINT);
+
+    let nonce = blake2b(epk.concat(pk), 24);
+    let key = hsalsa20(x25519(esk, pk), zeros(16));
+
+    let message = utf8Bytes(value);
+    let stream = xsalsa20Stream(key, nonce, 32 + message.length);
+    let ciphertext = message.map(function (b, i) {
+        return b ^ stream[32 + i];
+    });
+    let tag = poly1305(ciphertext, stream.slice(0, 32));
+    return crypto.toBase64(epk.concat(tag, ciphertext));
+};
+
+// seal encrypts value for the holder of the public key with a fresh
+// ephemeral key, as crypto_box_seal does. Anyone who can guess the ephemeral
+// key can open the box, see crypto.randomBytes for where it comes from.
+let seal = function (value, publicKey) {
+    return sealWithKey(value, publicKey, crypto.randomBytes(32));
+};
+
+exports.seal = seal;
+exports.sealWithKey = sealWithKey;
+exports.x25519 = x25519;
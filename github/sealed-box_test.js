@@ -0,0 +1,75 @@
+// Known-answer tests for github/sealed-box: node github/sealed-box_test.js
+const testing = require("../common/testing");
+const assert = testing.assert;
+const test = testing.test;
+
+const rt = testing.runtime();
+const crypto = rt.require("common/crypto");
+const sealedBox = rt.require("github/sealed-box");
+
+let x25519Hex = function (scalar, point) {
+    return crypto.toHex(sealedBox.x25519(crypto.fromHex(scalar), crypto.fromHex(point)));
+};
+
+// RFC 7748, section 5.2
+test("X25519 test vectors", function () {
+    assert.strictEqual(x25519Hex(
+        "a546e36bf0527c9d3b16154b82465edd62144c0ac1fc5a18506a2244ba449ac4",
+        "e6db6867583030db3594c1a424b15f7c726624ec26b3353b10a903a6d0ab1c4c"),
+        "c3da55379de9c6908e94ea4df28d084f32eccf03491c71f754b4075577a28552");
+    assert.strictEqual(x25519Hex(
+        "4b66e9d4d1b4673c5ad22691957d6af5c11b6421e0ea01d42ca4169e7918ba0d",
+        "e5210f12786811d3f4b7959d0538ae2c31dbe7106fc03c3efc4cd549c715a493"),
+        "95cbde9476e8907d7aade45cb4b873f88b595a68799fa152e6f8f7647aac7957");
+});
+
+// RFC 7748, section 6.1
+test("X25519 Diffie-Hellman", function () {
+    let base = "0900000000000000000000000000000000000000000000000000000000000000";
+    let alice = "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a";
+    let bob = "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb";
+    let alicePublic = "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a";
+    let bobPublic = "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f";
+    let shared = "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742";
+    assert.strictEqual(x25519Hex(alice, base), alicePublic);
+    assert.strictEqual(x25519Hex(bob, base), bobPublic);
+    assert.strictEqual(x25519Hex(alice, bobPublic), shared);
+    assert.strictEqual(x25519Hex(bob, alicePublic), shared);
+});
+
+// The expected boxes come from libsodium: crypto_box_easy with the ephemeral
+// key and the BLAKE2b nonce, each checked to open with crypto_box_seal_open.
+// The recipient is Bob from RFC 7748, the ephemeral key Alice's.
+const RECIPIENT = "3p7bfXt9wbTTW2HC7OQ1Nz+DQ8hbeGdNrfx+FG+IK08=";
+const EPHEMERAL = "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a";
+
+test("sealed box of an empty value", function () {
+    assert.strictEqual(sealedBox.sealWithKey("", RECIPIENT, crypto.fromHex(EPHEMERAL)),
+        "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmrzEK6YOJN4v7eTxer/3oB/");
+});
+
+test("sealed box of a short value", function () {
+    assert.strictEqual(sealedBox.sealWithKey("hello", RECIPIENT, crypto.fromHex(EPHEMERAL)),
+        "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmqtCTAUXM6iaDJRfcBHjfhfz2LAqoc=");
+});
+
+test("sealed box of a multi-block UTF-8 value", function () {
+    assert.strictEqual(sealedBox.sealWithKey("grüße 🔑".repeat(20), RECIPIENT, crypto.fromHex(EPHEMERAL)),
+        "hSDwCYkwp1R0i33ctD73Wg2/Og0mOBr066SpjqqbTmqERbMJLMQOgN6PAbHNNhKawHVveitnZnEg+d/rignq96zHO1ZM2Y1VnkxxIcU+" +
+        "MSSF6Z5906bGizJ0Fm6nzUzGfiuT87x9QohX93kqa6irIkdlPqRgOtmV4NHkwW6GCfAaG17enlHpFKy4xoptIjfgWefkR/Xzm+4GxHz3" +
+        "eoCnlwLNNFikk4D43w+BqbYU6T96hcbORLZsOKvDBZc3zEDGf8GoEaj1Hb/Zx8a9sY3cpUYn6zjx6KzZSHdUx6RZn/KJOW9b1biNyg3+" +
+        "1EZh85Z/F3+QXKt3Rd7MG/cz+Ljdvg1ahbAXuEPq4fMkliNd8/l9TjRn2o0S35UAgAVEKx54");
+});
+
+test("seal uses a fresh ephemeral key each time", function () {
+    let a = crypto.fromBase64(sealedBox.seal("hello", RECIPIENT));
+    let b = crypto.fromBase64(sealedBox.seal("hello", RECIPIENT));
+    assert.strictEqual(a.length, 32 + 16 + 5);
+    assert.notDeepStrictEqual(a.slice(0, 32), b.slice(0, 32));
+});
+
+test("seal rejects keys of the wrong size", function () {
+    assert.throws(function () {
+        sealedBox.seal("hello", "AAAA");
+    }, /public key must be 32 bytes, got 3/);
+});
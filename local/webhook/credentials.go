@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CredentialSource names where a credential for a provider API comes from.
+// Exactly one of the fields is set.
+type CredentialSource struct {
+	// Env is the name of an environment variable of the server.
+	Env string
+
+	// File is the path of a file holding the credential, such as one a
+	// secrets manager agent keeps up to date.
+	File string
+
+	// Command is a helper program and its arguments printing the credential
+	// to stdout, e.g. a secrets manager's CLI.
+	Command []string
+}
+
+// credentialSource reads the source of the credential name from a
+// definition:
+//
+//	token:
+//	  env: PROVIDER_TOKEN
+//	token:
+//	  file: /run/secrets/provider-token
+//	token:
+//	  command: [vault, kv, get, -field=token, secret/provider]
+func credentialSource(def map[string]interface{}, name string) (CredentialSource, error) {
+	var src CredentialSource
+	raw, ok := def[name].(map[string]interface{})
+	if !ok {
+		return src, fmt.Errorf("credential %s: expected an object with env, file or command", name)
+	}
+
+	src.Env, _ = raw["env"].(string)
+	src.File, _ = raw["file"].(string)
+	if command, ok := raw["command"].([]interface{}); ok {
+		for _, arg := range command {
+			s, ok := arg.(string)
+			if !ok {
+				return src, fmt.Errorf("credential %s: command arguments must be strings", name)
+			}
+			src.Command = append(src.Command, s)
+		}
+	}
+
+	set := 0
+	for _, given := range []bool{src.Env != "", src.File != "", len(src.Command) > 0} {
+		if given {
+			set++
+		}
+	}
+	if set != 1 {
+		return src, fmt.Errorf("credential %s: set exactly one of env, file or command", name)
+	}
+	return src, nil
+}
+
+// Resolve returns the credential, with surrounding whitespace such as the
+// trailing newline of a file or a command's output trimmed. The value is
+// never logged or put in an error: a failed command is reported with its exit
+// status only, as its output may hold part of the secret.
+func (src CredentialSource) Resolve(ctx context.Context) (string, error) {
+	var value string
+	switch {
+	case src.Env != "":
+		env, ok := os.LookupEnv(src.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", src.Env)
+		}
+		value = env
+	case src.File != "":
+		data, err := os.ReadFile(src.File)
+		if err != nil {
+			return "", fmt.Errorf("read credential file: %w", err)
+		}
+		value = string(data)
+	case len(src.Command) > 0:
+		var stdout bytes.Buffer
+		cmd := exec.CommandContext(ctx, src.Command[0], src.Command[1:]...)
+		cmd.Stdout = &stdout
+		slog.Debug("credential command", slog.String("command", src.Command[0]))
+		if err := cmd.Run(); err != nil {
+			var exit *exec.ExitError
+			if errors.As(err, &exit) {
+				return "", fmt.Errorf("credential command %s failed with %s", src.Command[0], exit.ProcessState)
+			}
+			return "", fmt.Errorf("credential command %s: %w", src.Command[0], err)
+		}
+		value = stdout.String()
+	default:
+		return "", errors.New("no credential source set")
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("credential is empty")
+	}
+	return value, nil
+}
+
+// Credential resolves the credential name of the entity of a request through
+// the source its definition sets, so handlers don't care where teams keep
+// their secrets.
+func Credential(req webhookRequest, name string) (string, error) {
+	src, err := credentialSource(req.Definition, name)
+	if err != nil {
+		return "", err
+	}
+	value, err := src.Resolve(req.Ctx())
+	if err != nil {
+		return "", fmt.Errorf("credential %s: %w", name, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func credentialRequest(source map[string]interface{}) webhookRequest {
+	return webhookRequest{Definition: map[string]interface{}{"token": source}}
+}
+
+func TestCredentialFromEnv(t *testing.T) {
+	t.Setenv("PROVIDER_TOKEN", " from-env\n")
+
+	value, err := Credential(credentialRequest(map[string]interface{}{"env": "PROVIDER_TOKEN"}), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "from-env" {
+		t.Errorf("expected from-env, got %q", value)
+	}
+
+	_, err = Credential(credentialRequest(map[string]interface{}{"env": "PROVIDER_TOKEN_UNSET"}), "token")
+	if err == nil || !strings.Contains(err.Error(), "PROVIDER_TOKEN_UNSET is not set") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestCredentialFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := Credential(credentialRequest(map[string]interface{}{"file": path}), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "from-file" {
+		t.Errorf("expected from-file, got %q", value)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	_, err = Credential(credentialRequest(map[string]interface{}{"file": missing}), "token")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not-exist error, got %v", err)
+	}
+}
+
+func TestCredentialFromCommand(t *testing.T) {
+	value, err := Credential(credentialRequest(map[string]interface{}{
+		"command": []interface{}{"sh", "-c", "printf '  from-command\\n\\n'"},
+	}), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "from-command" {
+		t.Errorf("expected from-command, got %q", value)
+	}
+}
+
+func TestFailedCredentialCommandHidesItsOutput(t *testing.T) {
+	_, err := Credential(credentialRequest(map[string]interface{}{
+		"command": []interface{}{"sh", "-c", "echo s3cret; echo s3cret >&2; exit 3"},
+	}), "token")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("expected the output to stay out of the error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("expected the exit status, got %v", err)
+	}
+}
+
+func TestCredentialNeedsOneSource(t *testing.T) {
+	for _, source := range []map[string]interface{}{
+		{},
+		{"env": "A", "file": "/b"},
+		{"command": []interface{}{"echo", 1}},
+	} {
+		if _, err := Credential(credentialRequest(source), "token"); err == nil {
+			t.Errorf("expected an error for %v", source)
+		}
+	}
+	if _, err := Credential(webhookRequest{}, "token"); err == nil {
+		t.Error("expected an error without a source")
+	}
+}
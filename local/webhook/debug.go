@@ -0,0 +1,41 @@
+package main
+
+import "net/http"
+
+// debugEndpoints enables the /debug/ routes. It is off unless -debug is passed.
+var debugEndpoints bool
+
+// debugState returns the persisted state of every entity path on GET and
+// removes it on DELETE, to start a test session from scratch.
+func debugState(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		writeError(w, http.StatusNotFound, "state persistence is disabled")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		all, err := store.All()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		data, err := marshalBody(all)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "encode state: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		if err := store.Clear(); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+	}
+}
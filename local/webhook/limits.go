@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// maxBodySize and bodyReadTimeout bound the size of a request body and the
+// time a client may take to send it, so a single client can't exhaust memory
+// or hold a handler with a slow upload.
+var (
+	maxBodySize     int64 = 4 << 20
+	bodyReadTimeout       = 30 * time.Second
+)
+
+// withBodyLimit applies maxBodySize and bodyReadTimeout to the request body.
+func withBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		if bodyReadTimeout > 0 {
+			_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(bodyReadTimeout))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyErrorStatus maps an error reading the request body to the status to
+// answer with: 413 when the body exceeds maxBodySize, 408 when reading it
+// timed out and 400 otherwise.
+func bodyErrorStatus(err error) int {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return http.StatusRequestTimeout
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOversizedBodyIsRejected(t *testing.T) {
+	defer func(size int64) { maxBodySize = size }(maxBodySize)
+	maxBodySize = 64
+
+	srv := httptest.NewServer(Chain(http.HandlerFunc(hello), webhookChain()...))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"within limit", `{"context":{"action":"create","path":"ns/app"}}`, http.StatusOK},
+		{"over limit", `{"definition":{"data":"` + strings.Repeat("x", 128) + `"},"context":{"action":"create","path":"ns/app"}}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(srv.URL, "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status: expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errPathBusy is returned by pathLocks.Lock when it must not wait for a busy path.
+var errPathBusy = errors.New("another action is running for this path")
+
+// pathLocks serializes requests for the same entity path so that concurrent
+// lifecycle actions can't interleave their state reads and writes.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+// pathLock is held while its channel contains a token. refs counts the
+// requests holding or waiting for it, the entry is dropped when it reaches zero.
+type pathLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newPathLocks() *pathLocks {
+	return &pathLocks{locks: make(map[string]*pathLock)}
+}
+
+// Lock acquires the lock for path and returns the function releasing it. If
+// wait is false it fails with errPathBusy instead of waiting for the current
+// holder; otherwise it waits until the lock is free or ctx is done.
+func (p *pathLocks) Lock(ctx context.Context, path string, wait bool) (func(), error) {
+	p.mu.Lock()
+	l, ok := p.locks[path]
+	if !ok {
+		l = &pathLock{ch: make(chan struct{}, 1)}
+		p.locks[path] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	if wait {
+		select {
+		case l.ch <- struct{}{}:
+		case <-ctx.Done():
+			p.release(path, l)
+			return nil, ctx.Err()
+		}
+	} else {
+		select {
+		case l.ch <- struct{}{}:
+		default:
+			p.release(path, l)
+			return nil, errPathBusy
+		}
+	}
+
+	return func() {
+		<-l.ch
+		p.release(path, l)
+	}, nil
+}
+
+func (p *pathLocks) release(path string, l *pathLock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(p.locks, path)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentRequestsForOnePathAreSerialized(t *testing.T) {
+	s, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, router = s, ActionRouter{
+		"update": func(req webhookRequest) webhookResponse {
+			count, _ := req.State["count"].(float64)
+			// Give other requests a chance to read the same count if the
+			// path lock doesn't hold them back.
+			time.Sleep(time.Millisecond)
+			return webhookResponse{State: map[string]interface{}{"count": count + 1}}
+		},
+	}
+	t.Cleanup(func() { store, router = nil, nil })
+
+	const n = 50
+	body := `{"context":{"action":"update","path":"ns/counter"}}`
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			hello(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Errorf("status %d: %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	state, err := store.Load("ns/counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["count"] != float64(n) {
+		t.Errorf("count: expected %d, got %v", n, state["count"])
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// requestInfo collects what the handler learned about a request so the
+// logging middleware can report it once the response has been written.
+type requestInfo struct {
+	ID      string
+	Context webhookContext
+}
+
+// setRequestContext records the decoded webhook context for the request log.
+func setRequestContext(r *http.Request, ctx webhookContext) {
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+		info.Context = ctx
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// responseRecorder captures the status code and body size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// withLogging tags every request with an X-Request-Id and logs it together
+// with the webhook context, response size and handler latency. Webhook
+// requests are also counted in metrics.
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{ID: newRequestID()}
+		w.Header().Set("X-Request-Id", info.ID)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)))
+
+		duration := time.Since(start)
+		if r.URL.Path != "/healthz" && r.URL.Path != "/metrics" {
+			metrics.Observe(info.Context.Action, rec.status, duration)
+		}
+
+		slog.Info("request",
+			slog.String("id", info.ID),
+			slog.String("method", r.Method),
+			slog.String("url", r.URL.Path),
+			slog.String("action", info.Context.Action),
+			slog.String("status", info.Context.Status),
+			slog.String("path", info.Context.Path),
+			slog.Int("code", rec.status),
+			slog.Int("bytes", rec.size),
+			slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+		)
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// serverMetrics counts handled requests. It is filled in by withLogging and
+// exposed on /metrics in the Prometheus text format.
+type serverMetrics struct {
+	mu       sync.Mutex
+	total    uint64
+	errors   uint64
+	byAction map[string]uint64
+	buckets  []uint64
+	sum      float64
+}
+
+var metrics = newServerMetrics()
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		byAction: make(map[string]uint64),
+		buckets:  make([]uint64, len(latencyBuckets)),
+	}
+}
+
+// Observe records a finished request. Responses with a 4xx or 5xx status
+// count as errors.
+func (m *serverMetrics) Observe(action string, status int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.total++
+	if status >= http.StatusBadRequest {
+		m.errors++
+	}
+	m.byAction[action]++
+
+	seconds := d.Seconds()
+	m.sum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP webhook_requests_total Webhook requests handled.\n")
+	b.WriteString("# TYPE webhook_requests_total counter\n")
+	fmt.Fprintf(&b, "webhook_requests_total %d\n", m.total)
+
+	b.WriteString("# HELP webhook_requests_by_action_total Webhook requests handled per lifecycle action.\n")
+	b.WriteString("# TYPE webhook_requests_by_action_total counter\n")
+	actions := make([]string, 0, len(m.byAction))
+	for action := range m.byAction {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		fmt.Fprintf(&b, "webhook_requests_by_action_total{action=%q} %d\n", action, m.byAction[action])
+	}
+
+	b.WriteString("# HELP webhook_request_errors_total Webhook requests answered with a 4xx or 5xx status.\n")
+	b.WriteString("# TYPE webhook_request_errors_total counter\n")
+	fmt.Fprintf(&b, "webhook_request_errors_total %d\n", m.errors)
+
+	b.WriteString("# HELP webhook_request_duration_seconds Webhook request latency.\n")
+	b.WriteString("# TYPE webhook_request_duration_seconds histogram\n")
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(&b, "webhook_request_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.buckets[i])
+	}
+	fmt.Fprintf(&b, "webhook_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.total)
+	fmt.Fprintf(&b, "webhook_request_duration_seconds_sum %g\n", m.sum)
+	fmt.Fprintf(&b, "webhook_request_duration_seconds_count %d\n", m.total)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps a handler with one cross-cutting concern such as logging
+// or authentication.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with the middlewares in order, the first one being the
+// outermost.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// DefaultChain is the middleware NewServer wraps every route in: request
+// logging and metrics, panic recovery, then bearer token authentication.
+func DefaultChain() []Middleware {
+	return []Middleware{withLogging, withRecovery, withAuth}
+}
+
+// webhookChain is the middleware specific to the lifecycle route.
+func webhookChain() []Middleware {
+	return []Middleware{withBodyLimit, withRecording, allowMethods(http.MethodPost)}
+}
+
+// allowMethods answers requests with any other method with 405.
+func allowMethods(methods ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, m := range methods {
+				if r.Method == m {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+		})
+	}
+}
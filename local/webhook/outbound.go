@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// OutboundOptions configures the HTTP client handlers use to call provider
+// APIs.
+type OutboundOptions struct {
+	// Proxy is the URL of the proxy for every request, overriding
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY. "direct" sends requests without
+	// a proxy; empty follows the environment.
+	Proxy string
+
+	// CAFile and CAPEM add the certificates of a private CA, from a PEM file
+	// or PEM text, to the system roots, for self-hosted endpoints.
+	CAFile string
+	CAPEM  string
+
+	// InsecureSkipVerify turns off verification of the provider's
+	// certificate. It is meant for trying out endpoints with throwaway
+	// certificates only, and logs a warning for every client.
+	InsecureSkipVerify bool
+}
+
+// outboundOptions reads the options of an entity from its definition, so a
+// single entity can use another proxy than the rest:
+//
+//	proxy: http://proxy.internal:3128
+//	ca-file: /etc/ssl/internal-ca.pem
+//	ca-pem: "-----BEGIN CERTIFICATE-----..."
+//	insecure-skip-verify: false
+func outboundOptions(def map[string]interface{}) OutboundOptions {
+	var opts OutboundOptions
+	opts.Proxy, _ = def["proxy"].(string)
+	opts.CAFile, _ = def["ca-file"].(string)
+	opts.CAPEM, _ = def["ca-pem"].(string)
+	opts.InsecureSkipVerify, _ = def["insecure-skip-verify"].(bool)
+	return opts
+}
+
+// NewOutboundClient returns an HTTP client for provider APIs. Requests go
+// through the proxy of the options or of the environment; TLS to the
+// provider is verified through the proxy as without one, against the system
+// roots and the CA of the options. The TLS settings belong to the client
+// alone, other clients keep the defaults.
+func NewOutboundClient(opts OutboundOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	roots, err := rootCAs(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots, InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.InsecureSkipVerify {
+		slog.Warn("INSECURE: TLS certificate verification is off for provider API calls, " +
+			"anyone on the network path can read and change them; set ca-file or ca-pem instead")
+	}
+
+	switch opts.Proxy {
+	case "":
+		transport.Proxy = http.ProxyFromEnvironment
+	case "direct":
+		transport.Proxy = nil
+	default:
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %s", maskedURL(opts.Proxy))
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		slog.Debug("outbound proxy", slog.String("proxy", proxy.Redacted()))
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// rootCAs returns the system roots with the CA of the options added, or nil
+// for the system roots alone when the options have none.
+func rootCAs(opts OutboundOptions) (*x509.CertPool, error) {
+	if opts.CAFile == "" && opts.CAPEM == "" {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if opts.CAFile != "" {
+		data, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA file %s holds no PEM certificates", opts.CAFile)
+		}
+	}
+	if opts.CAPEM != "" && !pool.AppendCertsFromPEM([]byte(opts.CAPEM)) {
+		return nil, fmt.Errorf("ca-pem holds no PEM certificates")
+	}
+	return pool, nil
+}
+
+// maskedURL returns a URL for logs and errors with its password hidden. A
+// URL that doesn't parse is hidden entirely, as it may hold credentials in a
+// form url.Parse rejects.
+func maskedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(unparsable URL)"
+	}
+	return u.Redacted()
+}
+
+// outboundClients holds a client per set of options, so entities with the
+// same options share connections.
+var outboundClients sync.Map
+
+// OutboundClient returns the client for calls made on behalf of the entity of
+// a request, configured from its definition.
+func OutboundClient(req webhookRequest) (*http.Client, error) {
+	opts := outboundOptions(req.Definition)
+	if client, ok := outboundClients.Load(opts); ok {
+		return client.(*http.Client), nil
+	}
+
+	client, err := NewOutboundClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := outboundClients.LoadOrStore(opts, client)
+	return actual.(*http.Client), nil
+}
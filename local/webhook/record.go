@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// recordEntry is one line of a recording: the raw request Monk sent and the
+// response the server answered with.
+type recordEntry struct {
+	Request  json.RawMessage `json:"request"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// recorder appends request/response pairs to a JSON lines file.
+type recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// recording captures webhook traffic when set with -record.
+var recording *recorder
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+
+	return &recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (r *recorder) Record(entry recordEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(entry)
+}
+
+func (r *recorder) Close() error {
+	return r.f.Close()
+}
+
+// bodyRecorder keeps a copy of everything written to the response.
+type bodyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *bodyRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection.
+func (rec *bodyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// withRecording stores each request and its response in the recording.
+func withRecording(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if recording == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, bodyErrorStatus(err), "read request: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		rec := &bodyRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		entry := recordEntry{Request: rawJSON(body), Status: rec.status, Response: rawJSON(rec.body.Bytes())}
+		if err := recording.Record(entry); err != nil {
+			slog.Error("record request", slog.Any("error", err))
+		}
+	})
+}
+
+// rawJSON returns b as a raw JSON value, quoting it as a string when it is not
+// valid JSON so that malformed requests can still be recorded. replay sends
+// such strings back unquoted.
+func rawJSON(b []byte) json.RawMessage {
+	if json.Valid(b) {
+		return json.RawMessage(bytes.Clone(b))
+	}
+
+	quoted, _ := json.Marshal(string(b))
+	return quoted
+}
+
+// replay re-posts every recorded request to target and compares the answers
+// with the recorded responses. It returns an error if any of them differ.
+func replay(path, target string) error {
+	// Read the whole recording up front, the target may be appending to it.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read recording: %w", err)
+	}
+
+	total, failed := 0, 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		total++
+
+		var entry recordEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("line %d: %w", total, err)
+		}
+
+		request := []byte(entry.Request)
+		var raw string
+		if json.Unmarshal(request, &raw) == nil {
+			request = []byte(raw)
+		}
+
+		status, body, err := post(target, request)
+		if err != nil {
+			return fmt.Errorf("request %d: %w", total, err)
+		}
+
+		if status != entry.Status || !sameJSON(body, entry.Response) {
+			failed++
+			fmt.Printf("--- FAIL: request %d\n", total)
+			fmt.Printf("    request:  %s\n", entry.Request)
+			fmt.Printf("    recorded: %d %s\n", entry.Status, entry.Response)
+			fmt.Printf("    got:      %d %s\n", status, bytes.TrimSpace(body))
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL\t%d of %d responses differ\n", failed, total)
+		return fmt.Errorf("%d of %d responses differ", failed, total)
+	}
+
+	fmt.Printf("ok\t%d responses match\n", total)
+	return nil
+}
+
+func post(target string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("WEBHOOK_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// sameJSON reports whether a and b encode the same JSON value, ignoring
+// formatting and key order.
+func sameJSON(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(bytes.TrimSpace(a), bytes.TrimSpace(b))
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// withRecovery turns a panic in a handler into a 500 response so that one bad
+// request doesn't take down the server. The stack trace is logged but never
+// sent to the client.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			var id string
+			if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+				id = info.ID
+			}
+			slog.Error("handler panic",
+				slog.String("id", id),
+				slog.String("error", fmt.Sprint(v)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// stateKeyEnv names the environment variable holding the base64 encoded
+// AES key sensitive state fields are encrypted with.
+const stateKeyEnv = "WEBHOOK_STATE_KEY"
+
+// Markers replacing a sensitive field in a state file.
+const (
+	encryptedMarker = "$encrypted"
+	redactedMarker  = "$redacted"
+)
+
+// errNoStateKey is returned when a handler marks state fields sensitive but
+// the store can neither encrypt nor redact them.
+var errNoStateKey = errors.New("no " + stateKeyEnv + " is set to encrypt them; set it or pass -redact-sensitive")
+
+// newStateCipher returns an AES-GCM cipher for key, a base64 encoded 16, 24
+// or 32 byte AES key.
+func newStateCipher(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", stateKeyEnv, err)
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", stateKeyEnv, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// protect returns a copy of state for writing to disk, with each of the
+// sensitive fields encrypted, or redacted and kept in memory when the store
+// has no key. The entity path and field name are authenticated along with
+// the value so an encrypted field can't be moved to another entity.
+func (s *fileStore) protect(path string, state map[string]interface{}, sensitive []string) (map[string]interface{}, error) {
+	if len(sensitive) == 0 {
+		return state, nil
+	}
+	if s.cipher == nil && !s.redact {
+		return nil, fmt.Errorf("state for %s marks %q sensitive but %w", path, sensitive, errNoStateKey)
+	}
+
+	out := make(map[string]interface{}, len(state))
+	for k, v := range state {
+		out[k] = v
+	}
+
+	for _, field := range sensitive {
+		value, ok := state[field]
+		if !ok {
+			continue
+		}
+
+		if s.cipher == nil {
+			if s.kept[path] == nil {
+				s.kept[path] = make(map[string]interface{})
+			}
+			s.kept[path][field] = value
+			out[field] = map[string]interface{}{redactedMarker: true}
+			continue
+		}
+
+		plain, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s of %s: %w", field, path, err)
+		}
+		nonce := make([]byte, s.cipher.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("encrypt %s of %s: %w", field, path, err)
+		}
+		sealed := s.cipher.Seal(nonce, nonce, plain, []byte(path+"\x00"+field))
+		out[field] = map[string]interface{}{encryptedMarker: base64.StdEncoding.EncodeToString(sealed)}
+	}
+
+	return out, nil
+}
+
+// reveal restores the sensitive fields of a state read from disk. Redacted
+// fields are filled in from memory and dropped if the server was restarted
+// since they were saved.
+func (s *fileStore) reveal(path string, state map[string]interface{}) (map[string]interface{}, error) {
+	for field, value := range state {
+		marker, ok := value.(map[string]interface{})
+		if !ok || len(marker) != 1 {
+			continue
+		}
+
+		if _, ok := marker[redactedMarker]; ok {
+			if kept, ok := s.kept[path][field]; ok {
+				state[field] = kept
+			} else {
+				delete(state, field)
+			}
+			continue
+		}
+
+		encoded, ok := marker[encryptedMarker].(string)
+		if !ok {
+			continue
+		}
+		if s.cipher == nil {
+			return nil, fmt.Errorf("state for %s has encrypted field %s but no %s is set", path, field, stateKeyEnv)
+		}
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < s.cipher.NonceSize() {
+			return nil, fmt.Errorf("decrypt %s of %s: malformed value", field, path)
+		}
+		nonce, ciphertext := sealed[:s.cipher.NonceSize()], sealed[s.cipher.NonceSize():]
+		plain, err := s.cipher.Open(nil, nonce, ciphertext, []byte(path+"\x00"+field))
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s of %s: %w", field, path, err)
+		}
+		var v interface{}
+		if err := json.Unmarshal(plain, &v); err != nil {
+			return nil, fmt.Errorf("decode %s of %s: %w", field, path, err)
+		}
+		state[field] = v
+	}
+
+	return state, nil
+}
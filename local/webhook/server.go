@@ -1,8 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type webhookContext struct {
@@ -15,46 +31,439 @@ type webhookRequest struct {
 	Definition map[string]interface{} `json:"definition"`
 	State      map[string]interface{} `json:"state"`
 	Context    webhookContext         `json:"context"`
+
+	ctx context.Context
+}
+
+// Ctx returns the request's context, which is cancelled when Monk goes away
+// or the action runs past handlerTimeout. Handlers should pass it to any
+// outgoing calls so they stop promptly.
+func (r webhookRequest) Ctx() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
 }
 
 type webhookResponse struct {
 	Output []string               `json:"output,omitempty"`
 	State  map[string]interface{} `json:"state,omitempty"`
+
+	// Sensitive names the top-level State fields, such as passwords or keys,
+	// that must not be written to disk in plain text. Monk still receives them.
+	Sensitive []string `json:"-"`
 }
 
-func hello(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	var req webhookRequest
-	err := decoder.Decode(&req)
+// ActionRouter maps a lifecycle action (create, update, delete, check-readiness
+// or any custom action) to the function handling it.
+type ActionRouter map[string]func(webhookRequest) webhookResponse
+
+// router is consulted for every request. When it is nil the server falls back
+// to echoing the request back to Monk.
+var router ActionRouter
+
+// store persists state between requests. It is nil when persistence is
+// disabled, in which case only the state sent by Monk is used.
+var store *fileStore
+
+// locks serializes requests per Context.Path. When lockWait is false a request
+// for a busy path is rejected with 409 instead of waiting for its turn.
+var (
+	locks    = newPathLocks()
+	lockWait = true
+)
+
+// handlerTimeout bounds how long a request may wait for its path lock and run
+// its handler. Zero disables the limit.
+var handlerTimeout = 60 * time.Second
+
+// prettyJSON indents response bodies for reading them during debugging.
+var prettyJSON bool
+
+// marshalBody encodes a response body in canonical form, indented when
+// prettyJSON is set, so the same response is always the same bytes.
+func marshalBody(v interface{}) ([]byte, error) {
+	data, err := canonicalJSON(v)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if !prettyJSON {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return nil, err
 	}
-	
+	return buf.Bytes(), nil
+}
+
+// canonicalJSON encodes v with the keys of every object sorted. encoding/json
+// already sorts map keys, but state values may be json.RawMessage or types with
+// their own MarshalJSON, which keep whatever order they were produced in, so
+// the encoding is decoded and encoded again. Numbers are kept as written.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeError responds with the given status and a JSON body describing the error.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	data, err := marshalBody(errorResponse{Error: msg})
+	if err != nil {
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// echo reports the action, status and state it received and stores the
+// definition and context as the new state.
+func echo(req webhookRequest) (webhookResponse, error) {
 	state, err := json.Marshal(req.State)
 	if err != nil {
-		panic(err)
+		return webhookResponse{}, fmt.Errorf("encode state: %w", err)
 	}
 
-	resp := webhookResponse{
+	return webhookResponse{
 		Output: []string{"ACTION " + req.Context.Action, "STATUS " + req.Context.Status, "STATE " + string(state)},
 		State: map[string]interface{}{
-				"def": req.Definition,
-				"ctx": req.Context,
+			"def": req.Definition,
+			"ctx": req.Context,
 		},
+	}, nil
+}
+
+// missingFields lists the request fields needed for dispatch that were left empty.
+func missingFields(req webhookRequest) []string {
+	var missing []string
+	if req.Context.Action == "" {
+		missing = append(missing, "context.action")
+	}
+	if req.Context.Path == "" {
+		missing = append(missing, "context.path")
+	}
+	return missing
+}
+
+// requestFields and contextFields are the keys a webhook request and its
+// context may carry.
+var (
+	requestFields = []string{"definition", "state", "context"}
+	contextFields = []string{"status", "action", "path"}
+)
+
+// unknownFields lists the keys of raw that are not in known, sorted and
+// prefixed with prefix.
+func unknownFields(raw map[string]json.RawMessage, prefix string, known []string) []string {
+	var unknown []string
+	for key := range raw {
+		if !slices.Contains(known, key) {
+			unknown = append(unknown, prefix+key)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// decodeRequest decodes the single JSON object in body. On failure it also
+// returns the status to answer with: 400 for an empty or malformed body or
+// data after the object, 422 listing every unknown field, or the status
+// bodyErrorStatus picks when the body couldn't be read.
+func decodeRequest(body io.Reader) (webhookRequest, int, error) {
+	var req webhookRequest
+	decoder := json.NewDecoder(body)
+
+	var raw map[string]json.RawMessage
+	err := decoder.Decode(&raw)
+	switch {
+	case errors.Is(err, io.EOF):
+		return req, http.StatusBadRequest, errors.New("empty body")
+	case err != nil:
+		return req, bodyErrorStatus(err), err
+	}
+
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		if status := bodyErrorStatus(err); err != nil && status != http.StatusBadRequest {
+			return req, status, err
+		}
+		return req, http.StatusBadRequest, errors.New("unexpected data after the JSON object")
+	}
+
+	unknown := unknownFields(raw, "", requestFields)
+	var rawContext map[string]json.RawMessage
+	if json.Unmarshal(raw["context"], &rawContext) == nil {
+		unknown = append(unknown, unknownFields(rawContext, "context.", contextFields)...)
+	}
+	if len(unknown) > 0 {
+		quoted := make([]string, len(unknown))
+		for i, field := range unknown {
+			quoted[i] = strconv.Quote(field)
+		}
+		return req, http.StatusUnprocessableEntity, errors.New("unknown fields " + strings.Join(quoted, ", "))
+	}
+
+	targets := []interface{}{&req.Definition, &req.State, &req.Context}
+	for i, field := range requestFields {
+		if value, ok := raw[field]; ok {
+			if err := json.Unmarshal(value, targets[i]); err != nil {
+				return req, http.StatusBadRequest, fmt.Errorf("%s: %w", field, err)
+			}
+		}
 	}
+	return req, 0, nil
+}
 
-	data, err := json.Marshal(resp)
+func hello(w http.ResponseWriter, r *http.Request) {
+	req, status, err := decodeRequest(r.Body)
 	if err != nil {
-		panic(err)
+		writeError(w, status, "invalid request: "+err.Error())
+		return
+	}
+	setRequestContext(r, req.Context)
+
+	if missing := missingFields(req); len(missing) > 0 {
+		writeError(w, http.StatusUnprocessableEntity, "invalid request: missing required fields "+strings.Join(missing, ", "))
+		return
+	}
+
+	ctx := r.Context()
+	if handlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handlerTimeout)
+		defer cancel()
+	}
+	req.ctx = ctx
+
+	unlock, err := locks.Lock(ctx, req.Context.Path, lockWait)
+	switch {
+	case errors.Is(err, errPathBusy):
+		writeError(w, http.StatusConflict, "path "+strconv.Quote(req.Context.Path)+": "+err.Error())
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "timed out waiting for path "+strconv.Quote(req.Context.Path))
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, "wait for path "+strconv.Quote(req.Context.Path)+": "+err.Error())
+		return
+	}
+	defer unlock()
+
+	if store != nil && len(req.State) == 0 {
+		req.State, err = store.Load(req.Context.Path)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	var resp webhookResponse
+	if router == nil {
+		resp, err = echo(req)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else {
+		handler, ok := router[req.Context.Action]
+		if !ok {
+			writeError(w, http.StatusNotFound, "no handler registered for action "+strconv.Quote(req.Context.Action))
+			return
+		}
+		resp = handler(req)
 	}
 
-	_, err = w.Write(data)
+	// A handler that overran its deadline may have given up half way, don't
+	// persist what it returned.
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "action "+strconv.Quote(req.Context.Action)+" timed out after "+handlerTimeout.String())
+		return
+	}
+
+	if store != nil && resp.State != nil {
+		if err := store.Save(req.Context.Path, resp.State, resp.Sensitive); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	data, err := marshalBody(resp)
 	if err != nil {
-		panic(err)
+		writeError(w, http.StatusInternalServerError, "encode response: "+err.Error())
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// isFlagSet reports whether the named flag was passed on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// listenAddr resolves the listen address: an explicit -addr wins, then
+// WEBHOOK_ADDR, then the flag default.
+func listenAddr(addr string) string {
+	if !isFlagSet("addr") {
+		if env := os.Getenv("WEBHOOK_ADDR"); env != "" {
+			return env
+		}
+	}
+	return addr
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to finish once
+// the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// healthz reports that the server is up and accepting requests.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"ok"}`))
+}
+
+// NewServer returns a webhook server for addr with the lifecycle, health and
+// metrics routes registered, plus the debug routes when debugEndpoints is set.
+// The routes are wrapped in chain, or in DefaultChain when none is given.
+// Start it with ListenAndServe and stop it with Shutdown.
+func NewServer(addr string, chain ...Middleware) *http.Server {
+	if len(chain) == 0 {
+		chain = DefaultChain()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthz)
+	mux.Handle("/metrics", metrics)
+	if debugEndpoints {
+		mux.HandleFunc("/debug/state", debugState)
+	}
+	mux.Handle("/", Chain(http.HandlerFunc(hello), webhookChain()...))
+
+	return &http.Server{Addr: addr, Handler: Chain(mux, chain...), ReadHeaderTimeout: bodyReadTimeout}
 }
 
 func main() {
-	http.HandleFunc("/", hello)
-	http.ListenAndServe(":8090", nil)
+	addr := flag.String("addr", ":8090", "address to listen on, also read from WEBHOOK_ADDR")
+	persist := flag.Bool("persist", false, "keep entity state on disk between requests")
+	stateDir := flag.String("state-dir", "state", "directory holding persisted entity state")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file, requires -tls-key")
+	tlsKey := flag.String("tls-key", "", "TLS private key file, requires -tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "serve HTTPS with a generated self-signed certificate")
+	recordFile := flag.String("record", "", "append every request and response to this JSON lines file")
+	replayFile := flag.String("replay", "", "re-post the requests recorded in this file to -target and compare responses")
+	target := flag.String("target", "http://127.0.0.1:8090/", "webhook URL used by -replay")
+	flag.Int64Var(&maxBodySize, "max-body-size", maxBodySize, "largest request body accepted, in bytes")
+	flag.DurationVar(&bodyReadTimeout, "read-timeout", bodyReadTimeout, "time allowed to send a request body, 0 disables the limit")
+	flag.DurationVar(&handlerTimeout, "handler-timeout", handlerTimeout, "time allowed for a lifecycle action, 0 disables the limit")
+	flag.BoolVar(&debugEndpoints, "debug", false, "serve /debug/state to inspect and clear persisted state")
+	flag.BoolVar(&prettyJSON, "pretty", false, "indent JSON responses")
+	redact := flag.Bool("redact-sensitive", false, "keep sensitive state fields out of state files when "+stateKeyEnv+" is not set")
+	failFast := flag.Bool("lock-fail-fast", false, "reject a request with 409 while another action runs for the same path instead of waiting")
+	flag.Parse()
+
+	if *replayFile != "" {
+		if err := replay(*replayFile, *target); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		return
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be set together")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	if *persist {
+		var err error
+		store, err = newFileStore(*stateDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if key := os.Getenv(stateKeyEnv); key != "" {
+			store.cipher, err = newStateCipher(key)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		store.redact = *redact
+	}
+
+	authToken = os.Getenv("WEBHOOK_TOKEN")
+	lockWait = !*failFast
+
+	if *recordFile != "" {
+		var err error
+		recording, err = newRecorder(*recordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recording.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := NewServer(listenAddr(*addr))
+	serve := srv.ListenAndServe
+	switch {
+	case *tlsCert != "":
+		serve = func() error { return srv.ListenAndServeTLS(*tlsCert, *tlsKey) }
+	case *tlsSelfSigned:
+		cert, fingerprint, err := selfSignedCert()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("self-signed certificate SHA-256 fingerprint: %s", fingerprint)
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		serve = func() error { return srv.ListenAndServeTLS("", "") }
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("webhook server listening on %s", srv.Addr)
+		errc <- serve()
+	}()
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Print("shutting down webhook server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHelloValidatesRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		errors []string
+	}{
+		{
+			name:   "valid",
+			body:   `{"definition":{},"state":{},"context":{"status":"","action":"create","path":"ns/app"}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "empty body",
+			body:   ``,
+			status: http.StatusBadRequest,
+			errors: []string{"empty body"},
+		},
+		{
+			name:   "malformed body",
+			body:   `{"context":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing action",
+			body:   `{"context":{"path":"ns/app"}}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []string{"context.action"},
+		},
+		{
+			name:   "missing context",
+			body:   `{"definition":{}}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []string{"context.action", "context.path"},
+		},
+		{
+			name:   "extra fields",
+			body:   `{"context":{"action":"create","path":"ns/app","retry":1},"extra":true,"other":null}`,
+			status: http.StatusUnprocessableEntity,
+			errors: []string{`"context.retry"`, `"extra"`, `"other"`},
+		},
+		{
+			name:   "trailing data",
+			body:   `{"context":{"action":"create","path":"ns/app"}} {"context":{}}`,
+			status: http.StatusBadRequest,
+			errors: []string{"unexpected data after the JSON object"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			hello(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			if w.Code != tt.status {
+				t.Fatalf("status: expected %d, got %d\nbody: %s", tt.status, w.Code, w.Body)
+			}
+			var resp errorResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			for _, msg := range tt.errors {
+				if !strings.Contains(resp.Error, msg) {
+					t.Errorf("error %q does not mention %s", resp.Error, msg)
+				}
+			}
+		})
+	}
+}
+
+// blockingRouter returns a router whose create handler signals started and
+// then blocks until its request context is done, reporting why on done.
+func blockingRouter(started chan<- struct{}, done chan<- error) ActionRouter {
+	return ActionRouter{
+		"create": func(req webhookRequest) webhookResponse {
+			close(started)
+			select {
+			case <-req.Ctx().Done():
+				done <- req.Ctx().Err()
+			case <-time.After(10 * time.Second):
+				done <- errors.New("context was not cancelled")
+			}
+			return webhookResponse{State: map[string]interface{}{"id": "x"}}
+		},
+	}
+}
+
+func TestHandlerStopsWhenRequestIsCancelled(t *testing.T) {
+	started, done := make(chan struct{}), make(chan error, 1)
+	router = blockingRouter(started, done)
+	t.Cleanup(func() { router = nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	body := `{"context":{"action":"create","path":"ns/app"}}`
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)).WithContext(ctx)
+
+	returned := make(chan struct{})
+	go func() {
+		hello(httptest.NewRecorder(), r)
+		close(returned)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("hello did not return within 1s of the request being cancelled")
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("handler context: expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestHandlerTimeoutAnswers504(t *testing.T) {
+	defer func(timeout time.Duration) { handlerTimeout = timeout }(handlerTimeout)
+	handlerTimeout = 50 * time.Millisecond
+
+	started, done := make(chan struct{}), make(chan error, 1)
+	router = blockingRouter(started, done)
+	t.Cleanup(func() { router = nil })
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	hello(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"context":{"action":"create","path":"ns/app"}}`)))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hello took %s with a %s handler timeout", elapsed, handlerTimeout)
+	}
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status: expected %d, got %d", http.StatusGatewayTimeout, w.Code)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("handler context: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
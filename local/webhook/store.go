@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fileStore persists entity state between requests as one JSON file per
+// entity path, so a later lifecycle call sees what an earlier one returned.
+// Fields a handler marks sensitive are encrypted with cipher, or, when it is
+// nil and redact is set, replaced on disk and kept in memory for the run.
+type fileStore struct {
+	mu     sync.Mutex
+	dir    string
+	cipher cipher.AEAD
+	redact bool
+	kept   map[string]map[string]interface{}
+}
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+
+	return &fileStore{dir: dir, kept: make(map[string]map[string]interface{})}, nil
+}
+
+func (s *fileStore) file(path string) string {
+	return filepath.Join(s.dir, url.PathEscape(path)+".json")
+}
+
+// Load returns the state saved for path, or nil if nothing was saved yet.
+func (s *fileStore) Load(path string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.file(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read state for %s: %w", path, err)
+	}
+
+	var state map[string]interface{}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decode state for %s: %w", path, err)
+	}
+
+	return s.reveal(path, state)
+}
+
+// Save replaces the state stored for path. The fields named in sensitive are
+// never written in plain text.
+func (s *fileStore) Save(path string, state map[string]interface{}, sensitive []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.protect(path, state, sensitive)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode state for %s: %w", path, err)
+	}
+
+	if err := writeFile(s.file(path), data); err != nil {
+		return fmt.Errorf("write state for %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// writeFile replaces name with data by writing a temporary file in the same
+// directory and renaming it into place, so a crash mid-write leaves the
+// previous state intact instead of a truncated file.
+func writeFile(name string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), ".state-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// All returns the state stored for every entity path, as written to disk.
+func (s *fileStore) All() (map[string]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list state: %w", err)
+	}
+
+	all := make(map[string]map[string]interface{})
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		path, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read state for %s: %w", path, err)
+		}
+		var state map[string]interface{}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("decode state for %s: %w", path, err)
+		}
+		all[path] = state
+	}
+
+	return all, nil
+}
+
+// Clear removes the state stored for every entity path.
+func (s *fileStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("list state: %w", err)
+	}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			return fmt.Errorf("clear state: %w", err)
+		}
+	}
+	clear(s.kept)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package testutil provides assertions for tests exercising the local webhook
+// server and the handlers registered on it.
+//
+// The server lives in package main and cannot be imported, so Request and
+// Response mirror its wire format.
+package testutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Context is the lifecycle context Monk sends with every request.
+type Context struct {
+	Status string `json:"status"`
+	Action string `json:"action"`
+	Path   string `json:"path"`
+}
+
+// Request is the body Monk posts to the webhook.
+type Request struct {
+	Definition map[string]interface{} `json:"definition"`
+	State      map[string]interface{} `json:"state"`
+	Context    Context                `json:"context"`
+}
+
+// Response is the body the webhook answers with.
+type Response struct {
+	Output []string               `json:"output,omitempty"`
+	State  map[string]interface{} `json:"state,omitempty"`
+}
+
+// DecodeResponse decodes a webhook response body, failing the test if it is
+// not valid JSON.
+func DecodeResponse(tb testing.TB, body []byte) Response {
+	tb.Helper()
+
+	var resp Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		tb.Fatalf("decode webhook response: %v\nbody: %s", err, body)
+	}
+	return resp
+}
+
+// AssertState checks the state value at key, which may be a dot-separated
+// path into nested objects (e.g. "ctx.action"). Numbers are compared by value,
+// so an expected int matches the float64 produced by decoding JSON.
+func AssertState(tb testing.TB, resp Response, key string, expected interface{}) {
+	tb.Helper()
+
+	actual, ok := lookup(resp.State, key)
+	if !ok {
+		tb.Errorf("state has no key %q\nstate: %s", key, dump(resp.State))
+		return
+	}
+
+	if !reflect.DeepEqual(normalize(actual), normalize(expected)) {
+		tb.Errorf("state %q:\n  expected: %s\n  actual:   %s", key, dump(expected), dump(actual))
+	}
+}
+
+// AssertOutputContains checks that at least one output line contains substr.
+func AssertOutputContains(tb testing.TB, resp Response, substr string) {
+	tb.Helper()
+
+	for _, line := range resp.Output {
+		if strings.Contains(line, substr) {
+			return
+		}
+	}
+	tb.Errorf("no output line contains %q\noutput:\n  %s", substr, strings.Join(resp.Output, "\n  "))
+}
+
+// AssertAction checks the lifecycle action a request was sent for.
+func AssertAction(tb testing.TB, req Request, action string) {
+	tb.Helper()
+
+	if req.Context.Action != action {
+		tb.Errorf("action:\n  expected: %q\n  actual:   %q", action, req.Context.Action)
+	}
+}
+
+func lookup(state map[string]interface{}, key string) (interface{}, bool) {
+	var current interface{} = state
+	for _, part := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// normalize round-trips v through JSON so values compare the way they would
+// after being decoded from a response.
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func dump(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
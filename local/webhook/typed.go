@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TypedRequest is a webhookRequest with the definition and state decoded into
+// the types its handler declares.
+type TypedRequest[D, S any] struct {
+	Definition D
+	State      S
+	Context    webhookContext
+
+	ctx context.Context
+}
+
+// Ctx returns the request's context, see webhookRequest.Ctx.
+func (r TypedRequest[D, S]) Ctx() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// TypedResponse is the answer of a typed handler. A nil State leaves the
+// stored state alone, like a webhookResponse without state.
+type TypedResponse[S any] struct {
+	Output    []string
+	State     *S
+	Sensitive []string
+}
+
+// Typed adapts a handler of typed definitions and state to an ActionRouter
+// entry. Definition and state are converted through JSON, so the field tags
+// of D and S name their keys:
+//
+//	type bucketDef struct {
+//		Name string `json:"name"`
+//	}
+//	type bucketState struct {
+//		ID string `json:"id"`
+//	}
+//
+//	router = ActionRouter{
+//		"create": Typed(func(req TypedRequest[bucketDef, bucketState]) (TypedResponse[bucketState], error) {
+//			return TypedResponse[bucketState]{State: &bucketState{ID: req.Definition.Name}}, nil
+//		}),
+//	}
+//
+// Untyped handlers keep working as they are, and a handler can move to typed
+// state one side at a time with map[string]interface{} for the other.
+// A definition or state that doesn't fit the types, or an error from the
+// handler, is reported in the output and leaves the stored state alone.
+func Typed[D, S any](handle func(TypedRequest[D, S]) (TypedResponse[S], error)) func(webhookRequest) webhookResponse {
+	return func(req webhookRequest) webhookResponse {
+		typed := TypedRequest[D, S]{Context: req.Context, ctx: req.ctx}
+		if err := convert(req.Definition, &typed.Definition); err != nil {
+			return failed(fmt.Errorf("decode definition: %w", err))
+		}
+		if err := convert(req.State, &typed.State); err != nil {
+			return failed(fmt.Errorf("decode state: %w", err))
+		}
+
+		resp, err := handle(typed)
+		if err != nil {
+			return failed(err)
+		}
+
+		out := webhookResponse{Output: resp.Output, Sensitive: resp.Sensitive}
+		if resp.State != nil {
+			if err := convert(*resp.State, &out.State); err != nil {
+				return failed(fmt.Errorf("encode state: %w", err))
+			}
+		}
+		return out
+	}
+}
+
+// convert copies from into the value that to points at by way of JSON. Numbers
+// decoded into interface values stay json.Number, so large IDs keep their
+// digits. A nil map converts to the zero value.
+func convert(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(to)
+}
+
+// failed reports err in the output without changing the state.
+func failed(err error) webhookResponse {
+	return webhookResponse{Output: []string{"ERROR " + err.Error()}}
+}
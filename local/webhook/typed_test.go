@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type counterDef struct {
+	Step int `json:"step"`
+}
+
+type counterState struct {
+	Count int    `json:"count"`
+	Label string `json:"label,omitempty"`
+}
+
+func TestTypedHandlerGetsDecodedDefinitionAndState(t *testing.T) {
+	handler := Typed(func(req TypedRequest[counterDef, counterState]) (TypedResponse[counterState], error) {
+		if req.Definition.Step == 0 {
+			return TypedResponse[counterState]{}, errors.New("step must be set")
+		}
+		state := req.State
+		state.Count += req.Definition.Step
+		return TypedResponse[counterState]{Output: []string{"counted"}, State: &state}, nil
+	})
+
+	resp := handler(webhookRequest{
+		Definition: map[string]interface{}{"step": 2},
+		State:      map[string]interface{}{"count": 40, "label": "a"},
+		Context:    webhookContext{Action: "update", Path: "ns/counter"},
+	})
+	data, err := json.Marshal(resp.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"count":42,"label":"a"}` {
+		t.Errorf("state: got %s", data)
+	}
+	if len(resp.Output) != 1 || resp.Output[0] != "counted" {
+		t.Errorf("output: got %q", resp.Output)
+	}
+
+	resp = handler(webhookRequest{Context: webhookContext{Action: "create", Path: "ns/counter"}})
+	if resp.State != nil || len(resp.Output) != 1 || resp.Output[0] != "ERROR step must be set" {
+		t.Errorf("handler error: got state %v, output %q", resp.State, resp.Output)
+	}
+}
+
+func TestTypedHandlerRejectsMismatchedState(t *testing.T) {
+	called := false
+	handler := Typed(func(req TypedRequest[map[string]interface{}, counterState]) (TypedResponse[counterState], error) {
+		called = true
+		return TypedResponse[counterState]{}, nil
+	})
+
+	resp := handler(webhookRequest{State: map[string]interface{}{"count": "many"}})
+	if called {
+		t.Error("handler ran with a state that doesn't fit its type")
+	}
+	if resp.State != nil || len(resp.Output) != 1 || !strings.HasPrefix(resp.Output[0], "ERROR decode state: ") {
+		t.Errorf("got state %v, output %q", resp.State, resp.Output)
+	}
+}
+
+func TestTypedHandlerStateIsPersisted(t *testing.T) {
+	s, err := newFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, router = s, ActionRouter{
+		"update": Typed(func(req TypedRequest[counterDef, counterState]) (TypedResponse[counterState], error) {
+			state := counterState{Count: req.State.Count + req.Definition.Step}
+			return TypedResponse[counterState]{State: &state}, nil
+		}),
+	}
+	t.Cleanup(func() { store, router = nil, nil })
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		body := `{"definition":{"step":5},"context":{"action":"update","path":"ns/counter"}}`
+		hello(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+
+	state, err := store.Load("ns/counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := json.Marshal(state["count"]); string(count) != "15" {
+		t.Errorf("count: got %s", count)
+	}
+}
@@ -0,0 +1,96 @@
+let cli = require("cli");
+let common = require("mongodb-atlas/common");
+let request = common.request;
+let isNotFound = common.isNotFound;
+
+let clusterPath = function (def) {
+    return "/groups/" + def["project-id"] + "/clusters/" + def["name"];
+};
+
+// regionConfig describes the cluster's nodes. The free tier runs on a
+// shared tenant, with the cloud provider given as the backing provider.
+let regionConfig = function (def) {
+    let size = def["instance-size"] || "M10";
+    let config = {
+        "providerName": def["provider"] || "AWS",
+        "regionName": def["region"] || "US_EAST_1",
+        "priority": 7,
+        "electableSpecs": {"instanceSize": size, "nodeCount": 3}
+    };
+    if (size === "M0") {
+        config["providerName"] = "TENANT";
+        config["backingProviderName"] = def["provider"] || "AWS";
+        config["electableSpecs"] = {"instanceSize": size};
+    }
+    return config;
+};
+
+let createCluster = function (def) {
+    let body = {
+        "name": def["name"],
+        "clusterType": "REPLICASET",
+        "replicationSpecs": [{"regionConfigs": [regionConfig(def)]}]
+    };
+    if (def["mongodb-version"]) {
+        body["mongoDBMajorVersion"] = def["mongodb-version"];
+    }
+    let cluster = request(def, "post", "/groups/" + def["project-id"] + "/clusters", body);
+    return {"id": cluster.id, "name": cluster.name, "state": cluster.stateName};
+};
+
+// updateCluster resizes the cluster when the instance size changed. The
+// provider and region of an existing cluster are left alone.
+let updateCluster = function (def, state) {
+    let cluster = request(def, "get", clusterPath(def));
+    let current = cluster.replicationSpecs[0].regionConfigs[0];
+    if (current.electableSpecs.instanceSize === (def["instance-size"] || "M10")) {
+        return state;
+    }
+    current.electableSpecs.instanceSize = def["instance-size"] || "M10";
+    let updated = request(def, "patch", clusterPath(def), {"replicationSpecs": cluster.replicationSpecs});
+    cli.output("Resizing cluster " + def["name"] + " to " + current.electableSpecs.instanceSize);
+    return Object.assign({}, state, {"state": updated.stateName});
+};
+
+let checkReadiness = function (def, state) {
+    let cluster = request(def, "get", clusterPath(def));
+    if (cluster.stateName !== "IDLE") {
+        throw new Error("cluster " + def["name"] + " is " + cluster.stateName);
+    }
+    let strings = cluster.connectionStrings || {};
+    return {
+        "id": cluster.id,
+        "name": cluster.name,
+        "state": cluster.stateName,
+        "mongodb-version": cluster.mongoDBVersion,
+        "srv-address": strings.standardSrv,
+        "connection-string": strings.standard
+    };
+};
+
+let deleteCluster = function (def) {
+    try {
+        request(def, "delete", clusterPath(def));
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createCluster(def);
+        case "update":
+            return updateCluster(def, state);
+        case "check-readiness":
+            return checkReadiness(def, state);
+        case "purge":
+            deleteCluster(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
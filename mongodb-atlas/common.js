@@ -0,0 +1,84 @@
+// Atlas Administration API access shared by the MongoDB Atlas entities. A
+// definition authenticates with a programmatic API key, over HTTP digest
+// authentication, or with a service account, whose tokens are minted and
+// cached here.
+let http = require("http");
+let secret = require("secret");
+let api = require("common/api");
+let tokenCache = require("common/token-cache");
+
+const BASE_URL = "https://cloud.mongodb.com";
+const MEDIA_TYPE = "application/vnd.atlas.2023-02-01+json";
+
+// tokens caches service account tokens by client ID
+let tokens = tokenCache.tokenCache({
+    "key": function (def) {
+        return def["client-id"];
+    },
+    // getAuthToken mints a token with the client credentials grant
+    "getAuthToken": function (def) {
+        let res = http.post(BASE_URL + "/api/oauth/token", {
+            "headers": {
+                "Authorization": "Basic " + btoa(def["client-id"] + ":" + secret.get(def["client-secret"])),
+                "Content-Type": "application/x-www-form-urlencoded",
+                "Accept": "application/json"
+            },
+            "body": "grant_type=client_credentials"
+        });
+        if (res.error) {
+            throw new Error("get access token: " + res.error + ", " + res.body);
+        }
+        let body = JSON.parse(res.body);
+        return {"token": body.access_token, "expires-in": body.expires_in};
+    }
+});
+
+// usesApiKey tells whether a definition authenticates with a programmatic
+// API key rather than a service account
+let usesApiKey = function (def) {
+    if (def["public-key"] && def["private-key-secret"]) {
+        return true;
+    }
+    if (def["client-id"] && def["client-secret"]) {
+        return false;
+    }
+    throw new Error("set public-key and private-key-secret for an API key, or client-id and client-secret for a " +
+        "service account");
+};
+
+// accessToken returns a token for the Atlas service account, minting one
+// only when there is no cached token for the same account that is valid for
+// at least another minute. With token-cache-secret set the token is shared
+// across runs and entities.
+let accessToken = function (def) {
+    return tokens.token(def);
+};
+
+let atlas = api.client({
+    "name": "MongoDB Atlas",
+    "baseUrl": BASE_URL + "/api/atlas/v2",
+    "headers": function (def) {
+        let headers = {"Accept": MEDIA_TYPE};
+        if (!usesApiKey(def)) {
+            headers["Authorization"] = "Bearer " + accessToken(def);
+        }
+        return headers;
+    },
+    "digest": function (def) {
+        if (!usesApiKey(def)) {
+            return null;
+        }
+        return {"username": def["public-key"], "password": secret.get(def["private-key-secret"])};
+    },
+    "contentType": MEDIA_TYPE,
+    "message": function (body) {
+        return body.detail;
+    },
+    "code": function (body) {
+        return body.errorCode;
+    }
+});
+
+exports.accessToken = accessToken;
+exports.request = atlas.request;
+exports.isNotFound = api.isNotFound;
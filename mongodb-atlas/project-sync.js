@@ -0,0 +1,49 @@
+let cli = require("cli");
+let common = require("mongodb-atlas/common");
+let request = common.request;
+let isNotFound = common.isNotFound;
+
+let createProject = function (def) {
+    try {
+        let project = request(def, "get", "/groups/byName/" + encodeURIComponent(def["name"]));
+        cli.output("Project " + def["name"] + " already exists");
+        return project;
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+    return request(def, "post", "/groups", {"name": def["name"], "orgId": def["organization-id"]});
+};
+
+let deleteProject = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    try {
+        request(def, "delete", "/groups/" + state["id"]);
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            let project = createProject(def);
+            return {"id": project.id, "name": project.name};
+        case "update":
+            if (def["name"] !== state["name"]) {
+                request(def, "patch", "/groups/" + state["id"], {"name": def["name"]});
+            }
+            return {"id": state["id"], "name": def["name"]};
+        case "purge":
+            deleteProject(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
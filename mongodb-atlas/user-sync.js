@@ -0,0 +1,112 @@
+let cli = require("cli");
+let secret = require("secret");
+let common = require("mongodb-atlas/common");
+let request = common.request;
+let isNotFound = common.isNotFound;
+
+// password returns the user's password from its Monk secret, generating and
+// storing one on first use
+let password = function (def) {
+    try {
+        let value = secret.get(def["password-secret"]);
+        if (value) {
+            return value;
+        }
+    } catch (e) {
+        // not set yet
+    }
+    let value = secret.randString(24);
+    secret.set(def["password-secret"], value);
+    return value;
+};
+
+let userData = function (def) {
+    let data = {
+        "roles": (def["roles"] || [{"role": "readWriteAnyDatabase", "database": "admin"}]).map(function (role) {
+            return {"roleName": role.role, "databaseName": role.database || "admin"};
+        }),
+        "scopes": []
+    };
+    if (def["cluster"]) {
+        data["scopes"] = [{"name": def["cluster"], "type": "CLUSTER"}];
+    }
+    return data;
+};
+
+let userPath = function (def) {
+    return "/groups/" + def["project-id"] + "/databaseUsers/admin/" + encodeURIComponent(def["username"]);
+};
+
+// storeConnectionString writes the cluster's SRV connection string with the
+// user's credentials to a Monk secret
+let storeConnectionString = function (def) {
+    if (!def["connection-string-secret"] || !def["srv-address"]) {
+        return;
+    }
+    let uri = def["srv-address"].replace("mongodb+srv://",
+        "mongodb+srv://" + encodeURIComponent(def["username"]) + ":" + encodeURIComponent(password(def)) + "@");
+    secret.set(def["connection-string-secret"], uri);
+};
+
+let createUser = function (def) {
+    let data = userData(def);
+    data["databaseName"] = "admin";
+    data["username"] = def["username"];
+    data["password"] = password(def);
+    request(def, "post", "/groups/" + def["project-id"] + "/databaseUsers", data);
+    storeConnectionString(def);
+    return {"username": def["username"], "project-id": def["project-id"]};
+};
+
+// updateUser applies the roles and scopes and re-sends the password, so a
+// password rotated in the Monk secret reaches Atlas
+let updateUser = function (def, state) {
+    let data = userData(def);
+    data["password"] = password(def);
+    request(def, "patch", userPath(def), data);
+    storeConnectionString(def);
+    return state;
+};
+
+// rotatePassword sets a new generated password on the user. The Monk secret
+// only takes it once Atlas has, so a failed rotation leaves the working
+// password in place.
+let rotatePassword = function (def, state, args) {
+    let length = Number((args || {})["length"] || 24);
+    if (!(length >= 8 && length <= 256)) {
+        throw new Error("length must be between 8 and 256, got " + args["length"]);
+    }
+    let value = secret.randString(length);
+    request(def, "patch", userPath(def), {"password": value});
+    secret.set(def["password-secret"], value);
+    storeConnectionString(def);
+    cli.output("Password of " + def["username"] + " rotated, the new one is in the Monk secret " + def["password-secret"]);
+    return state;
+};
+
+let deleteUser = function (def) {
+    try {
+        request(def, "delete", userPath(def));
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createUser(def);
+        case "update":
+            return updateUser(def, state);
+        case "rotate-password":
+            return rotatePassword(def, state, ctx.args);
+        case "purge":
+            deleteUser(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,184 @@
+let cli = require("cli");
+let secret = require("secret");
+let api = require("common/api");
+let outputs = require("common/outputs");
+
+let neon = api.client({
+    "name": "Neon",
+    "baseUrl": function (def) {
+        return "https://console.neon.tech/api/v2/projects/" + def["project-id"];
+    },
+    "headers": function (def) {
+        return {
+            "Authorization": "Bearer " + secret.get(def["token-secret"]),
+            "Accept": "application/json"
+        };
+    },
+    "message": function (body) {
+        return body.message;
+    },
+    // creating a branch lists the branches twice, to adopt one and to find the parent
+    "cacheReads": true
+});
+let request = neon.request;
+let remove = neon.remove;
+
+// OPERATION is how Neon reports the progress of an operation
+const OPERATION = {
+    "status": "operation.status",
+    "done": ["finished", "skipped"],
+    "failed": ["failed", "error"],
+    "error": "operation.error"
+};
+
+let operationIds = function (res) {
+    return (res.operations || []).map(function (operation) {
+        return operation.id;
+    });
+};
+
+let computeSettings = function (def) {
+    return {
+        "autoscaling_limit_min_cu": def["min-cu"] || 0.25,
+        "autoscaling_limit_max_cu": def["max-cu"] || 1
+    };
+};
+
+let parentId = function (def) {
+    let branches = request(def, "get", "/branches").branches;
+    let parent = branches.find(function (branch) {
+        return def["parent"] ? branch.name === def["parent"] : branch.default;
+    });
+    if (!parent) {
+        throw new Error("parent branch " + (def["parent"] || "(default)") + " not found");
+    }
+    return parent.id;
+};
+
+let createBranch = function (def) {
+    let existing = request(def, "get", "/branches").branches.find(function (branch) {
+        return branch.name === def["name"];
+    });
+    if (existing) {
+        cli.output("Branch " + def["name"] + " already exists");
+        let endpoints = request(def, "get", "/branches/" + existing.id + "/endpoints").endpoints;
+        return {"branch-id": existing.id, "endpoint-id": endpoints.length ? endpoints[0].id : "", "operations": []};
+    }
+    let res = request(def, "post", "/branches", {
+        "branch": {"name": def["name"], "parent_id": parentId(def)},
+        "endpoints": [Object.assign({"type": "read_write"}, computeSettings(def))]
+    });
+    return {"branch-id": res.branch.id, "endpoint-id": res.endpoints[0].id, "operations": operationIds(res)};
+};
+
+// updateBranch renames the branch and resizes its endpoint when they differ
+// from the definition. The operations Neon starts for the changes are kept
+// in state and awaited by the readiness check.
+let updateBranch = function (def, state) {
+    let operations = [];
+    let branch = request(def, "get", "/branches/" + state["branch-id"]).branch;
+    if (branch.name !== def["name"]) {
+        let res = request(def, "patch", "/branches/" + branch.id, {"branch": {"name": def["name"]}});
+        operations = operations.concat(operationIds(res));
+        cli.output("Renamed branch " + branch.name + " to " + def["name"]);
+    }
+    let endpoint = request(def, "get", "/endpoints/" + state["endpoint-id"]).endpoint;
+    let compute = computeSettings(def);
+    if (endpoint.autoscaling_limit_min_cu !== compute.autoscaling_limit_min_cu ||
+        endpoint.autoscaling_limit_max_cu !== compute.autoscaling_limit_max_cu) {
+        let res = request(def, "patch", "/endpoints/" + endpoint.id, {"endpoint": compute});
+        operations = operations.concat(operationIds(res));
+        cli.output("Resized endpoint " + endpoint.id + " to " + compute.autoscaling_limit_min_cu + "-" +
+            compute.autoscaling_limit_max_cu + " CU");
+    }
+    return Object.assign({}, state, {"operations": operations});
+};
+
+// pendingOperations returns the operations that haven't finished yet and
+// fails if any of them failed
+let pendingOperations = function (def, ids) {
+    return ids.filter(function (id) {
+        try {
+            return neon.checkTask(def, "/operations/" + id, OPERATION) !== true;
+        } catch (e) {
+            throw new Error("operation " + id + " failed: " + e.message);
+        }
+    });
+};
+
+let connectionUri = function (def, branchId, pooled) {
+    let query = "?branch_id=" + branchId +
+        "&database_name=" + encodeURIComponent(def["database-name"] || "neondb") +
+        "&role_name=" + encodeURIComponent(def["role-name"] || "neondb_owner") +
+        "&pooled=" + pooled;
+    return request(def, "get", "/connection_uri" + query).uri;
+};
+
+let checkReadiness = function (def, state) {
+    let pending = pendingOperations(def, state["operations"] || []);
+    if (pending.length > 0) {
+        throw new Error(pending.length + " operations on branch " + def["name"] + " are still running");
+    }
+    let branch = request(def, "get", "/branches/" + state["branch-id"]).branch;
+    if (branch.current_state !== "ready") {
+        throw new Error("branch " + def["name"] + " is " + branch.current_state);
+    }
+    let endpoint = request(def, "get", "/endpoints/" + state["endpoint-id"]).endpoint;
+
+    // the URIs embed the role password, so they only go to secrets
+    secret.set(def["connection-uri-secret"], connectionUri(def, branch.id, false));
+    if (def["pooled-connection-uri-secret"]) {
+        secret.set(def["pooled-connection-uri-secret"], connectionUri(def, branch.id, true));
+    }
+    return {
+        "branch-id": branch.id,
+        "endpoint-id": endpoint.id,
+        "operations": [],
+        "host": endpoint.host,
+        "pooler-host": endpoint.host.replace(endpoint.id, endpoint.id + "-pooler")
+    };
+};
+
+let deleteBranch = function (def, state) {
+    if (!state["branch-id"]) {
+        return;
+    }
+    remove(def, "/branches/" + state["branch-id"]);
+};
+
+// testConnection checks through the API that the branch is ready and that its
+// endpoint accepts connections. The runtime has no Postgres client, so this
+// can't open a real connection. An idle endpoint counts as reachable, Neon
+// starts it on the first connection.
+let testConnection = function (def, state) {
+    let start = Date.now();
+    let branch = request(def, "get", "/branches/" + state["branch-id"]).branch;
+    if (branch.current_state !== "ready") {
+        throw new Error("branch " + def["name"] + " is " + branch.current_state);
+    }
+    let endpoint = request(def, "get", "/endpoints/" + state["endpoint-id"]).endpoint;
+    if (endpoint.disabled) {
+        throw new Error("endpoint " + endpoint.id + " is disabled");
+    }
+    cli.output("Endpoint " + endpoint.host + " is " + endpoint.current_state + " (" + (Date.now() - start) + "ms)");
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return outputs.apply(def, createBranch(def));
+        case "update":
+            return outputs.apply(def, updateBranch(def, state));
+        case "check-readiness":
+            return outputs.apply(def, checkReadiness(def, state));
+        case "test-connection":
+            testConnection(def, state);
+            return;
+        case "purge":
+            deleteBranch(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,23 @@
+// Netlify API access shared by the Netlify entities.
+let api = require("common/api");
+let secret = require("secret");
+
+let netlify = api.client({
+    "name": "Netlify",
+    "baseUrl": "https://api.netlify.com/api/v1",
+    "headers": function (def) {
+        return {"Authorization": "Bearer " + secret.get(def["token-secret"])};
+    },
+    "validate": {
+        "path": "/user",
+        "credentials": function (def) {
+            return "the access token in the Monk secret " + def["token-secret"];
+        }
+    },
+    "message": function (body) {
+        return body.message;
+    }
+});
+
+exports.request = netlify.request;
+exports.remove = netlify.remove;
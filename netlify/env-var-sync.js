@@ -0,0 +1,150 @@
+let cli = require("cli");
+let secret = require("secret");
+let crypto = require("common/crypto");
+let api = require("common/api");
+let common = require("netlify/common");
+let request = common.request;
+let remove = common.remove;
+
+// valueHash hashes the value of one context, keyed with the access token
+let valueHash = function (def, value) {
+    return crypto.valueHash(secret.get(def["token-secret"]), value);
+};
+
+let envPath = function (def, key) {
+    if (!def["site"]) {
+        throw new Error("site is required, set it or connect the variable to a netlify/site");
+    }
+    return "/accounts/" + encodeURIComponent(def["account-slug"]) + "/env" +
+        (key ? "/" + encodeURIComponent(key) : "") + "?site_id=" + encodeURIComponent(def["site"]);
+};
+
+// contextValues reads the value of every context from its Monk secret
+let contextValues = function (def) {
+    let values = {};
+    Object.keys(def["values"] || {}).sort().forEach(function (context) {
+        values[context] = secret.get(def["values"][context]);
+    });
+    if (Object.keys(values).length === 0) {
+        throw new Error("values needs at least one deploy context");
+    }
+    return values;
+};
+
+let scopes = function (def) {
+    return (def["scopes"] || ["builds", "functions", "runtime", "post-processing"]).slice().sort();
+};
+
+let envBody = function (def, values) {
+    return {
+        "key": def["key"],
+        "scopes": scopes(def),
+        "values": Object.keys(values).map(function (context) {
+            return {"context": context, "value": values[context]};
+        })
+    };
+};
+
+let envState = function (def, values) {
+    let hashes = {};
+    Object.keys(values).forEach(function (context) {
+        hashes[context] = valueHash(def, values[context]);
+    });
+    return {"site": def["site"], "key": def["key"], "scopes": scopes(def), "value-hashes": hashes};
+};
+
+let createEnvVar = function (def) {
+    let values = contextValues(def);
+    request(def, "post", envPath(def), [envBody(def, values)]);
+    cli.output("Set " + def["key"] + " for " + Object.keys(values).join(", "));
+    return envState(def, values);
+};
+
+// updateEnvVar only sends values whose hash changed, all of them even when
+// one fails. The state keeps the contexts that were updated and lists the
+// ones that failed, which the next update retries. Adding or removing a
+// context, or changing the scopes, replaces the whole variable. A variable
+// that got another key or moved to another site is created anew before the
+// old one is removed.
+let updateEnvVar = function (def, state) {
+    if (state["key"] !== def["key"] || (state["site"] && state["site"] !== def["site"])) {
+        let created = createEnvVar(def);
+        deleteEnvVar(def, state);
+        return created;
+    }
+    let values = contextValues(def);
+    let desired = envState(def, values);
+    let previous = state["value-hashes"] || {};
+
+    let sameContexts = JSON.stringify(Object.keys(previous).sort()) === JSON.stringify(Object.keys(values));
+    if (!sameContexts || JSON.stringify(state["scopes"]) !== JSON.stringify(desired["scopes"])) {
+        request(def, "put", envPath(def, def["key"]), envBody(def, values));
+        cli.output("Replaced " + def["key"] + " for " + Object.keys(values).join(", "));
+        return desired;
+    }
+
+    let changed = Object.keys(values).filter(function (context) {
+        return desired["value-hashes"][context] !== previous[context];
+    });
+    let result = api.batch(changed, function (context) {
+        request(def, "patch", envPath(def, def["key"]), {"context": context, "value": values[context]});
+        cli.output("Updated " + def["key"] + " for " + context);
+    }, {
+        "name": function (context) {
+            return "Updating " + def["key"] + " for " + context;
+        }
+    });
+    if (result.failed.length === 0) {
+        return desired;
+    }
+    // keep the previous hash of a failed context so the next update sends it
+    // again, and the failures for the readiness check to report
+    result.failed.forEach(function (f) {
+        if (f.item in previous) {
+            desired["value-hashes"][f.item] = previous[f.item];
+        } else {
+            delete desired["value-hashes"][f.item];
+        }
+    });
+    desired["failed"] = api.failures(result, function (context) {
+        return context;
+    });
+    return desired;
+};
+
+let deleteEnvVar = function (def, state) {
+    if (!state["key"]) {
+        return;
+    }
+    remove(def, envPath(Object.assign({}, def, {"site": state["site"] || def["site"]}), state["key"]));
+};
+
+// checkFailures fails with the deploy contexts the last update couldn't
+// update, each with its error
+let checkFailures = function (def, state) {
+    let failed = state["failed"] || {};
+    let contexts = Object.keys(failed);
+    if (contexts.length > 0) {
+        throw new Error(def["key"] + " failed to update for " + contexts.map(function (context) {
+            return context + " (" + failed[context] + ")";
+        }).join(", ") + ", run monk update to retry them");
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createEnvVar(def);
+        case "update":
+            return updateEnvVar(def, state);
+        case "purge":
+            deleteEnvVar(def, state);
+            return;
+        case "check-readiness":
+            checkFailures(def, state);
+            return state;
+        default:
+            // no action defined
+            return;
+    }
+}
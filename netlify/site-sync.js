@@ -0,0 +1,86 @@
+let cli = require("cli");
+let common = require("netlify/common");
+let request = common.request;
+let remove = common.remove;
+
+let buildSettings = function (def) {
+    let settings = {
+        "cmd": def["build-command"] || "",
+        "dir": def["publish-directory"] || ""
+    };
+    if (def["repo"]) {
+        settings["provider"] = def["repo-provider"] || "github";
+        settings["repo_path"] = def["repo"];
+        settings["repo_branch"] = def["repo-branch"] || "main";
+        if (def["installation-id"]) {
+            settings["installation_id"] = def["installation-id"];
+        }
+    }
+    return settings;
+};
+
+let siteState = function (site) {
+    return {
+        "id": site.id,
+        "name": site.name,
+        "account-slug": site.account_slug,
+        "url": site.ssl_url || site.url,
+        "admin-url": site.admin_url
+    };
+};
+
+let createSite = function (def) {
+    let body = {"name": def["name"]};
+    if (def["custom-domain"]) {
+        body["custom_domain"] = def["custom-domain"];
+    }
+    let settings = buildSettings(def);
+    if (def["repo"]) {
+        body["repo"] = {
+            "provider": settings["provider"],
+            "repo": settings["repo_path"],
+            "branch": settings["repo_branch"],
+            "cmd": settings["cmd"],
+            "dir": settings["dir"],
+            "installation_id": settings["installation_id"]
+        };
+    }
+    let path = def["account-slug"] ? "/" + def["account-slug"] + "/sites" : "/sites";
+    let site = request(def, "post", path, body);
+    if (!def["repo"]) {
+        site = request(def, "patch", "/sites/" + site.id, {"build_settings": settings});
+    }
+    cli.output("Created site " + site.name + " at " + (site.ssl_url || site.url));
+    return siteState(site);
+};
+
+let updateSite = function (def, state) {
+    let site = request(def, "patch", "/sites/" + state["id"], {
+        "name": def["name"],
+        "custom_domain": def["custom-domain"] || null,
+        "build_settings": buildSettings(def)
+    });
+    return siteState(site);
+};
+
+let deleteSite = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    remove(def, "/sites/" + state["id"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createSite(def);
+        case "update":
+            return updateSite(def, state);
+        case "purge":
+            deleteSite(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
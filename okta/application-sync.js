@@ -0,0 +1,124 @@
+let cli = require("cli");
+let secret = require("secret");
+let request = require("okta/common").request;
+let isNotFound = require("common/api").isNotFound;
+
+let grantTypes = function (def) {
+    return def["grant-types"] || ["authorization_code"];
+};
+
+let responseTypes = function (def) {
+    let types = [];
+    if (grantTypes(def).includes("authorization_code")) {
+        types.push("code");
+    }
+    if (grantTypes(def).includes("implicit")) {
+        types.push("id_token", "token");
+    }
+    return types.length ? types : ["code"];
+};
+
+let createApplication = function (def) {
+    let app = request(def, "post", "/apps", {
+        "name": "oidc_client",
+        "label": def["label"],
+        "signOnMode": "OPENID_CONNECT",
+        "credentials": {
+            "oauthClient": {"token_endpoint_auth_method": "client_secret_basic"}
+        },
+        "settings": {
+            "oauthClient": {
+                "application_type": "web",
+                "redirect_uris": def["redirect-uris"],
+                "post_logout_redirect_uris": def["post-logout-redirect-uris"] || [],
+                "grant_types": grantTypes(def),
+                "response_types": responseTypes(def)
+            }
+        }
+    });
+    // Okta returns the client secret only once, keep it in the Monk secret
+    // instead of reading it back later
+    secret.set(def["client-secret-secret"], app.credentials.oauthClient.client_secret);
+    return {"id": app.id, "client-id": app.credentials.oauthClient.client_id};
+};
+
+// reconcileUris keeps the current URIs that are still wanted, in their
+// current order, and appends the new ones
+let reconcileUris = function (label, current, desired) {
+    current = current || [];
+    desired = desired || [];
+    let removed = current.filter(function (uri) {
+        return !desired.includes(uri);
+    });
+    let added = desired.filter(function (uri) {
+        return !current.includes(uri);
+    });
+    removed.forEach(function (uri) {
+        cli.output("Removing " + label + " " + uri);
+    });
+    added.forEach(function (uri) {
+        cli.output("Adding " + label + " " + uri);
+    });
+    return {
+        "changed": removed.length > 0 || added.length > 0,
+        "uris": current.filter(function (uri) {
+            return desired.includes(uri);
+        }).concat(added)
+    };
+};
+
+let updateApplication = function (def, state) {
+    let app = request(def, "get", "/apps/" + state["id"]);
+    let client = app.settings.oauthClient;
+    let redirects = reconcileUris("redirect URI", client.redirect_uris, def["redirect-uris"]);
+    let logouts = reconcileUris("post logout redirect URI", client.post_logout_redirect_uris, def["post-logout-redirect-uris"]);
+    let grantsChanged = JSON.stringify(client.grant_types) !== JSON.stringify(grantTypes(def));
+    if (!redirects.changed && !logouts.changed && !grantsChanged && app.label === def["label"]) {
+        return state;
+    }
+
+    // the apps API replaces the whole application on PUT
+    app.label = def["label"];
+    client.redirect_uris = redirects.uris;
+    client.post_logout_redirect_uris = logouts.uris;
+    client.grant_types = grantTypes(def);
+    client.response_types = responseTypes(def);
+    request(def, "put", "/apps/" + state["id"], app);
+    return state;
+};
+
+// deleteApplication deactivates the application first, Okta refuses to
+// delete active ones
+let deleteApplication = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    try {
+        request(def, "post", "/apps/" + state["id"] + "/lifecycle/deactivate");
+        request(def, "delete", "/apps/" + state["id"]);
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+    try {
+        secret.remove(def["client-secret-secret"]);
+    } catch (error) {
+        cli.output("Secret not found");
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createApplication(def);
+        case "update":
+            return updateApplication(def, state);
+        case "purge":
+            deleteApplication(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,34 @@
+// Okta Management API access shared by the Okta entities.
+let api = require("common/api");
+let secret = require("secret");
+
+let okta = api.client({
+    "name": "Okta",
+    "baseUrl": function (def) {
+        return "https://" + def["domain"] + "/api/v1";
+    },
+    "headers": function (def) {
+        return {
+            "Authorization": "SSWS " + secret.get(def["token-secret"]),
+            "Accept": "application/json"
+        };
+    },
+    // Okta counts requests per minute for each endpoint, e.g. 500 for /groups
+    "rateLimit": {"per-second": 5, "burst": 10},
+    "validate": {
+        "path": "/users/me",
+        "credentials": function (def) {
+            return "the API token in the Monk secret " + def["token-secret"] + " for " + def["domain"];
+        }
+    },
+    "message": function (body) {
+        return body.errorSummary;
+    },
+    "code": function (body) {
+        return body.errorCode;
+    }
+});
+
+exports.request = okta.request;
+exports.remove = okta.remove;
+exports.listAll = okta.listAll;
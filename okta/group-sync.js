@@ -0,0 +1,49 @@
+let cli = require("cli");
+let common = require("okta/common");
+let request = common.request;
+let remove = common.remove;
+
+let profile = function (def) {
+    return {"name": def["name"], "description": def["description"] || ""};
+};
+
+let createGroup = function (def) {
+    // q matches name prefixes, so the group may be on any page of the results
+    let groups = common.listAll(def, "/groups?q=" + encodeURIComponent(def["name"]));
+    let existing = groups.find(function (group) {
+        return group.profile.name === def["name"];
+    });
+    if (existing) {
+        cli.output("Group " + def["name"] + " already exists");
+        return updateGroup(def, {"id": existing.id});
+    }
+    let group = request(def, "post", "/groups", {"profile": profile(def)});
+    return {"id": group.id, "name": group.profile.name};
+};
+
+let updateGroup = function (def, state) {
+    let group = request(def, "put", "/groups/" + state["id"], {"profile": profile(def)});
+    return {"id": group.id, "name": group.profile.name};
+};
+
+let deleteGroup = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    remove(def, "/groups/" + state["id"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createGroup(def);
+        case "update":
+            return updateGroup(def, state);
+        case "purge":
+            deleteGroup(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
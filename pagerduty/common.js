@@ -0,0 +1,31 @@
+// PagerDuty REST API access shared by the PagerDuty entities.
+let api = require("common/api");
+let secret = require("secret");
+
+let pagerduty = api.client({
+    "name": "PagerDuty",
+    "baseUrl": "https://api.pagerduty.com",
+    "headers": function (def) {
+        return {
+            "Authorization": "Token token=" + secret.get(def["token-secret"]),
+            "Accept": "application/vnd.pagerduty+json;version=2"
+        };
+    },
+    // PagerDuty allows 960 requests a minute for each API key
+    "rateLimit": {"per-second": 15, "burst": 15},
+    "validate": {
+        "path": "/abilities",
+        "credentials": function (def) {
+            return "the API key in the Monk secret " + def["token-secret"];
+        }
+    },
+    "message": function (body) {
+        return body.error.message + (body.error.errors ? ": " + body.error.errors.join("; ") : "");
+    },
+    "code": function (body) {
+        return body.error.code;
+    }
+});
+
+exports.request = pagerduty.request;
+exports.remove = pagerduty.remove;
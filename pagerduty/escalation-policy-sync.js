@@ -0,0 +1,55 @@
+let common = require("pagerduty/common");
+let request = common.request;
+let remove = common.remove;
+
+let policyData = function (def) {
+    return {
+        "type": "escalation_policy",
+        "name": def["name"],
+        "description": def["description"] || "",
+        "num_loops": def["num-loops"] || 0,
+        "escalation_rules": def["rules"].map(function (rule) {
+            let targets = (rule["users"] || []).map(function (id) {
+                return {"id": id, "type": "user_reference"};
+            }).concat((rule["schedules"] || []).map(function (id) {
+                return {"id": id, "type": "schedule_reference"};
+            }));
+            if (targets.length === 0) {
+                throw new Error("every escalation rule needs at least one user or schedule");
+            }
+            return {"escalation_delay_in_minutes": rule["delay"] || 30, "targets": targets};
+        })
+    };
+};
+
+let createPolicy = function (def) {
+    let policy = request(def, "post", "/escalation_policies", {"escalation_policy": policyData(def)}).escalation_policy;
+    return {"id": policy.id, "name": policy.name};
+};
+
+let updatePolicy = function (def, state) {
+    let policy = request(def, "put", "/escalation_policies/" + state["id"], {"escalation_policy": policyData(def)}).escalation_policy;
+    return {"id": policy.id, "name": policy.name};
+};
+
+let deletePolicy = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    remove(def, "/escalation_policies/" + state["id"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createPolicy(def);
+        case "update":
+            return updatePolicy(def, state);
+        case "purge":
+            deletePolicy(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
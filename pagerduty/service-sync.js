@@ -0,0 +1,99 @@
+let cli = require("cli");
+let secret = require("secret");
+let common = require("pagerduty/common");
+let request = common.request;
+let remove = common.remove;
+let computeDiff = require("common/diff").computeDiff;
+
+const INTEGRATION_NAME = "Events API v2";
+
+let serviceData = function (def) {
+    if (!def["escalation-policy"]) {
+        throw new Error("escalation-policy is required, set it or connect the service to a pagerduty/escalation-policy");
+    }
+    return {
+        "type": "service",
+        "name": def["name"],
+        "description": def["description"] || "",
+        "escalation_policy": {"id": def["escalation-policy"], "type": "escalation_policy_reference"},
+        "incident_urgency_rule": {"type": "constant", "urgency": def["urgency"] || "high"},
+        "acknowledgement_timeout": def["acknowledgement-timeout"] || null,
+        "auto_resolve_timeout": def["auto-resolve-timeout"] || null
+    };
+};
+
+// ensureIntegration adds an Events API v2 integration to the service if it
+// has none and writes its routing key to the Monk secret
+let ensureIntegration = function (def, service) {
+    if (!def["routing-key-secret"]) {
+        return;
+    }
+    let integration = (service.integrations || []).find(function (i) {
+        return i.type === "events_api_v2_inbound_integration" || i.summary === INTEGRATION_NAME;
+    });
+    if (integration) {
+        integration = request(def, "get", "/services/" + service.id + "/integrations/" + integration.id).integration;
+    } else {
+        integration = request(def, "post", "/services/" + service.id + "/integrations", {
+            "integration": {
+                "type": "events_api_v2_inbound_integration",
+                "name": INTEGRATION_NAME,
+                "service": {"id": service.id, "type": "service_reference"}
+            }
+        }).integration;
+        cli.output("Added " + INTEGRATION_NAME + " integration to " + def["name"]);
+    }
+    secret.set(def["routing-key-secret"], integration.integration_key);
+    return integration.id;
+};
+
+let createService = function (def) {
+    let service = request(def, "post", "/services", {"service": serviceData(def)}).service;
+    let integration = ensureIntegration(def, service);
+    return {"id": service.id, "name": service.name, "integration-id": integration || "", "url": service.html_url};
+};
+
+let updateService = function (def, state) {
+    let service = request(def, "get", "/services/" + state["id"]).service;
+    // the escalation policy is a reference that needs both its ID and type
+    let changes = computeDiff(service, serviceData(def), {"ignore": ["type"], "whole": ["escalation_policy"]});
+    if (Object.keys(changes).length > 0) {
+        cli.output("Updating " + Object.keys(changes).join(", ") + " of " + def["name"]);
+        changes["type"] = "service";
+        let integrations = service.integrations;
+        service = request(def, "put", "/services/" + state["id"], {"service": changes}).service;
+        service.integrations = service.integrations || integrations;
+    }
+    let integration = ensureIntegration(def, service);
+    return {"id": service.id, "name": service.name, "integration-id": integration || "", "url": service.html_url};
+};
+
+// deleteService deletes the service, which removes its integrations along
+// with it, and the Monk secret holding the routing key
+let deleteService = function (def, state) {
+    if (state["id"]) {
+        remove(def, "/services/" + state["id"]);
+    }
+    if (def["routing-key-secret"]) {
+        try {
+            secret.remove(def["routing-key-secret"]);
+        } catch (error) {
+            cli.output("Secret not found");
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createService(def);
+        case "update":
+            return updateService(def, state);
+        case "purge":
+            deleteService(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,104 @@
+let cli = require("cli");
+let secret = require("secret");
+let common = require("planetscale/common");
+let request = common.request;
+let remove = common.remove;
+
+let branchPath = function (def) {
+    return "/databases/" + def["database"] + "/branches/" + def["name"];
+};
+
+let createBranch = function (def) {
+    if (!def["database"]) {
+        throw new Error("database is required, set it or connect the branch to a planetscale/database");
+    }
+    return request(def, "post", "/databases/" + def["database"] + "/branches", {
+        "name": def["name"],
+        "parent_branch": def["parent-branch"] || "main"
+    });
+};
+
+// createPassword issues connection credentials for the branch and returns
+// the branch state holding them. The password is only returned once, so it
+// goes straight into a Monk secret and is never printed. A password issued
+// before is deleted once the new one is in place.
+let createPassword = function (def, state) {
+    let branch = request(def, "get", branchPath(def));
+    if (!branch.ready) {
+        throw new Error("branch " + def["name"] + " is not ready yet, its password can be created once it is");
+    }
+    let password = request(def, "post", branchPath(def) + "/passwords", {
+        // names are unique per branch, and the old password lives on until the new one is in place
+        "name": "monk-" + def["name"] + "-" + Date.now(),
+        "role": def["password-role"] || "readwriter"
+    });
+    secret.set(def["password-secret"], password.plain_text);
+    if (state["password-id"]) {
+        remove(def, branchPath(def) + "/passwords/" + state["password-id"]);
+    }
+    cli.output("Created password " + password.name + " for branch " + def["name"]);
+    return {
+        "name": branch.name,
+        "ready": true,
+        "host": password.access_host_url,
+        "username": password.username,
+        "password-id": password.id,
+        "password-secret": def["password-secret"]
+    };
+};
+
+let deleteBranch = function (def) {
+    remove(def, branchPath(def));
+    try {
+        secret.remove(def["password-secret"]);
+    } catch (error) {
+        cli.output("Secret not found");
+    }
+};
+
+// testConnection checks through the API that the branch is ready and that its
+// password still exists. The runtime has no MySQL client, so this can't open
+// a real connection.
+let testConnection = function (def, state) {
+    let start = Date.now();
+    let branch = request(def, "get", branchPath(def));
+    if (!branch.ready) {
+        throw new Error("branch " + def["name"] + " is not ready");
+    }
+    if (state["password-id"]) {
+        request(def, "get", branchPath(def) + "/passwords/" + state["password-id"]);
+    }
+    cli.output("Branch " + def["name"] + " at " + state["host"] + " is reachable for " + state["username"] +
+        " (" + (Date.now() - start) + "ms)");
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            let branch = createBranch(def);
+            return {"name": branch.name, "ready": branch.ready};
+        case "check-readiness":
+            let current = request(def, "get", branchPath(def));
+            if (!current.ready) {
+                throw new Error("branch " + def["name"] + " is not ready yet");
+            }
+            return Object.assign({}, state, {"ready": true});
+        case "update":
+            // a branch gets its password on the first update after it is ready
+            if (!state["password-id"]) {
+                return createPassword(def, state);
+            }
+            return state;
+        case "create-password":
+            return createPassword(def, state);
+        case "test-connection":
+            testConnection(def, state);
+            return;
+        case "purge":
+            deleteBranch(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
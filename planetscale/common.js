@@ -0,0 +1,23 @@
+// PlanetScale API access shared by the PlanetScale entities.
+let api = require("common/api");
+let secret = require("secret");
+
+let planetscale = api.client({
+    "name": "PlanetScale",
+    "baseUrl": function (def) {
+        return "https://api.planetscale.com/v1/organizations/" + def["organization"];
+    },
+    "headers": function (def) {
+        // PlanetScale expects "<token id>:<token>" without an auth scheme
+        return {"Authorization": def["token-id"] + ":" + secret.get(def["token-secret"])};
+    },
+    "message": function (body) {
+        return body.message;
+    },
+    "code": function (body) {
+        return body.code;
+    }
+});
+
+exports.request = planetscale.request;
+exports.remove = planetscale.remove;
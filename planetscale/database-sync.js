@@ -0,0 +1,37 @@
+let common = require("planetscale/common");
+let request = common.request;
+let remove = common.remove;
+
+let createDatabase = function (def) {
+    let body = {"name": def["name"]};
+    if (def["region"]) {
+        body["region"] = def["region"];
+    }
+    if (def["cluster-size"]) {
+        body["cluster_size"] = def["cluster-size"];
+    }
+    return request(def, "post", "/databases", body);
+};
+
+let toState = function (db) {
+    return {"name": db.name, "state": db.state, "html-url": db.html_url};
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return toState(createDatabase(def));
+        case "check-readiness":
+            let db = request(def, "get", "/databases/" + def["name"]);
+            if (db.state !== "ready") {
+                throw new Error("database is not ready yet: " + db.state);
+            }
+            return toState(db);
+        case "purge":
+            remove(def, "/databases/" + def["name"]);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
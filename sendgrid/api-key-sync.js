@@ -0,0 +1,60 @@
+let cli = require("cli");
+let secret = require("secret");
+let common = require("sendgrid/common");
+let request = common.request;
+let remove = common.remove;
+
+let keyData = function (def) {
+    let data = {"name": def["name"]};
+    if (def["scopes"] && def["scopes"].length > 0) {
+        data["scopes"] = def["scopes"];
+    }
+    return data;
+};
+
+// SendGrid shows the key only in the create response, so it goes straight
+// into a Monk secret and is never fetched again
+let createKey = function (def) {
+    let body = request(def, "post", "/api_keys", keyData(def));
+    secret.set(def["key-secret"], body.api_key);
+    return body;
+};
+
+let updateKey = function (def, id) {
+    return request(def, "put", "/api_keys/" + id, keyData(def));
+};
+
+let deleteKey = function (def, id) {
+    remove(def, "/api_keys/" + id);
+    try {
+        secret.remove(def["key-secret"]);
+    } catch (error) {
+        cli.output("Secret not found");
+    }
+};
+
+function main(def, state, ctx) {
+    let key = {};
+    switch (ctx.action) {
+        case "create":
+            key = createKey(def);
+            break;
+        case "update":
+            if (!state["api-key-id"]) {
+                key = createKey(def);
+                break;
+            }
+            // scopes and name can change without rotating the key
+            key = updateKey(def, state["api-key-id"]);
+            break;
+        case "purge":
+            if (state["api-key-id"]) {
+                deleteKey(def, state["api-key-id"]);
+            }
+            return;
+        default:
+            // no action defined
+            return;
+    }
+    return {"api-key-id": key.api_key_id, "name": key.name, "key-secret": def["key-secret"]};
+}
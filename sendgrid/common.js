@@ -0,0 +1,25 @@
+// SendGrid v3 API access shared by the SendGrid entities.
+let api = require("common/api");
+let secret = require("secret");
+
+let sendgrid = api.client({
+    "name": "SendGrid",
+    "baseUrl": "https://api.sendgrid.com/v3",
+    "headers": function (def) {
+        return {"Authorization": "Bearer " + secret.get(def["token-secret"])};
+    },
+    "validate": {
+        "path": "/scopes",
+        "credentials": function (def) {
+            return "the API key in the Monk secret " + def["token-secret"];
+        }
+    },
+    "message": function (body) {
+        return body.errors.map(function (e) {
+            return e.message;
+        }).join("; ");
+    }
+});
+
+exports.request = sendgrid.request;
+exports.remove = sendgrid.remove;
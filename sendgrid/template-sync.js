@@ -0,0 +1,55 @@
+let common = require("sendgrid/common");
+let request = common.request;
+let remove = common.remove;
+
+let versionData = function (def) {
+    let data = {
+        "name": def["version-name"] || def["name"],
+        "subject": def["subject"],
+        "html_content": def["html-content"],
+        "active": 1
+    };
+    if (def["plain-content"]) {
+        data["plain_content"] = def["plain-content"];
+    } else {
+        data["generate_plain_content"] = true;
+    }
+    return data;
+};
+
+let createTemplate = function (def) {
+    let template = request(def, "post", "/templates", {"name": def["name"], "generation": "dynamic"});
+    let version = request(def, "post", "/templates/" + template.id + "/versions", versionData(def));
+    return {"template-id": template.id, "version-id": version.id};
+};
+
+let updateTemplate = function (def, state) {
+    request(def, "patch", "/templates/" + state["template-id"], {"name": def["name"]});
+    let version = request(def, "patch", "/templates/" + state["template-id"] + "/versions/" + state["version-id"],
+        versionData(def));
+    return {"template-id": state["template-id"], "version-id": version.id};
+};
+
+let deleteTemplate = function (def, id) {
+    remove(def, "/templates/" + id);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createTemplate(def);
+        case "update":
+            if (!state["template-id"]) {
+                return createTemplate(def);
+            }
+            return updateTemplate(def, state);
+        case "purge":
+            if (state["template-id"]) {
+                deleteTemplate(def, state["template-id"]);
+            }
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
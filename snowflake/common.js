@@ -0,0 +1,110 @@
+let http = require("http");
+let secret = require("secret");
+let jwt = require("common/jwt");
+let crypto = require("common/crypto");
+
+// Snowflake rejects key-pair JWTs that are valid for more than an hour
+let JWT_LIFETIME = 3600;
+
+let accountUrl = function (def) {
+    let host = def["account"] + (def["region"] ? "." + def["region"] : "");
+    return "https://" + host.toLowerCase() + ".snowflakecomputing.com";
+};
+
+// keyPairJwt signs a key-pair JWT for the user with the private key. The
+// issuer names the public key by the SHA-256 fingerprint Snowflake shows as
+// RSA_PUBLIC_KEY_FP in DESC USER.
+let keyPairJwt = function (def) {
+    if (!def["user"]) {
+        throw new Error("user is required to sign in with private-key-secret");
+    }
+    let key = jwt.privateKey(secret.get(def["private-key-secret"]));
+    let account = def["account"].split(".")[0].toUpperCase();
+    let subject = account + "." + def["user"].toUpperCase();
+    let fingerprint = "SHA256:" + crypto.toBase64(crypto.sha256(jwt.publicKeyDer(key)));
+    let now = Math.floor(Date.now() / 1000);
+    return jwt.sign({
+        "iss": subject + "." + fingerprint,
+        "sub": subject,
+        "iat": now,
+        "exp": now + JWT_LIFETIME
+    }, key);
+};
+
+// tokens caches the token of each definition for the action, as signing a
+// JWT takes longer than the statements it authorizes
+let tokens = {};
+
+// authHeaders signs in with a key pair when private-key-secret is set, or
+// passes the token in token-secret as is
+let authHeaders = function (def) {
+    if (def["private-key-secret"]) {
+        let cacheKey = def["account"] + "/" + def["user"] + "/" + def["private-key-secret"];
+        if (!tokens[cacheKey]) {
+            tokens[cacheKey] = keyPairJwt(def);
+        }
+        return {
+            "Authorization": "Bearer " + tokens[cacheKey],
+            "X-Snowflake-Authorization-Token-Type": "KEYPAIR_JWT"
+        };
+    }
+    if (!def["token-secret"]) {
+        throw new Error("either private-key-secret and user or token-secret must be set");
+    }
+    return {
+        "Authorization": "Bearer " + secret.get(def["token-secret"]),
+        "X-Snowflake-Authorization-Token-Type": def["token-type"] || "OAUTH"
+    };
+};
+
+// execute runs a single statement through the SQL API and returns its result
+// set; a failed statement is reported with its Snowflake error code
+let execute = function (def, statement) {
+    let body = {"statement": statement, "timeout": 60};
+    if (def["role"]) {
+        body["role"] = def["role"];
+    }
+    let res = http.do(accountUrl(def) + "/api/v2/statements", {
+        "method": "POST",
+        "headers": Object.assign(authHeaders(def), {
+            "Content-Type": "application/json",
+            "Accept": "application/json"
+        }),
+        "body": JSON.stringify(body)
+    });
+    let result = {};
+    try {
+        result = JSON.parse(res.body);
+    } catch (e) {
+        // keep the raw body for the error
+    }
+    if (res.error) {
+        let message = result.message ? result.message + " (" + result.code + ")" : res.body;
+        throw new Error(res.error + ", " + message);
+    }
+    if (res.statusCode === 202) {
+        throw new Error("statement did not finish in time: " + statement);
+    }
+    return result;
+};
+
+// alreadyExists tells whether a CREATE failed because the object exists,
+// Snowflake error 002002
+let alreadyExists = function (error) {
+    return error.message.includes("(002002)");
+};
+
+let quote = function (identifier) {
+    return "\"" + identifier.replace(/"/g, "\"\"") + "\"";
+};
+
+let literal = function (value) {
+    return "'" + String(value).replace(/\\/g, "\\\\").replace(/'/g, "\\'") + "'";
+};
+
+exports.accountUrl = accountUrl;
+exports.keyPairJwt = keyPairJwt;
+exports.execute = execute;
+exports.alreadyExists = alreadyExists;
+exports.quote = quote;
+exports.literal = literal;
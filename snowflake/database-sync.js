@@ -0,0 +1,66 @@
+let cli = require("cli");
+let common = require("snowflake/common");
+let execute = common.execute;
+let quote = common.quote;
+let literal = common.literal;
+
+let properties = function (def) {
+    return [
+        "DATA_RETENTION_TIME_IN_DAYS = " + (def["data-retention-days"] === undefined ? 1 : def["data-retention-days"]),
+        "COMMENT = " + literal(def["comment"] || "")
+    ].join(" ");
+};
+
+// createDatabase creates the database, or adopts one of the same name that
+// already exists. The state records which of the two happened, so that
+// delete only drops databases the entity created.
+let createDatabase = function (def) {
+    try {
+        execute(def, "CREATE " + (def["transient"] ? "TRANSIENT " : "") + "DATABASE " + quote(def["name"]) + " " +
+            properties(def));
+        return {"name": def["name"], "created": true};
+    } catch (e) {
+        if (!common.alreadyExists(e)) {
+            throw e;
+        }
+    }
+    cli.output("Database " + def["name"] + " already exists, adopting it; it won't be dropped on delete");
+    execute(def, "ALTER DATABASE " + quote(def["name"]) + " SET " + properties(def));
+    return {"name": def["name"], "created": false};
+};
+
+let updateDatabase = function (def, state) {
+    if (!state["name"]) {
+        return createDatabase(def);
+    }
+    if (state["name"] !== def["name"]) {
+        execute(def, "ALTER DATABASE " + quote(state["name"]) + " RENAME TO " + quote(def["name"]));
+        cli.output("Renamed database " + state["name"] + " to " + def["name"]);
+    }
+    execute(def, "ALTER DATABASE " + quote(def["name"]) + " SET " + properties(def));
+    return {"name": def["name"], "created": state["created"] === true};
+};
+
+let deleteDatabase = function (def, state) {
+    if (state["created"] !== true) {
+        cli.output("Database " + (state["name"] || def["name"]) +
+            " wasn't created by this entity, leaving it in place");
+        return;
+    }
+    execute(def, "DROP DATABASE IF EXISTS " + quote(state["name"]));
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createDatabase(def);
+        case "update":
+            return updateDatabase(def, state);
+        case "purge":
+            deleteDatabase(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,67 @@
+let cli = require("cli");
+let common = require("snowflake/common");
+let execute = common.execute;
+let quote = common.quote;
+let literal = common.literal;
+
+let properties = function (def) {
+    return [
+        "WAREHOUSE_SIZE = " + literal((def["size"] || "XSMALL").toUpperCase()),
+        "AUTO_SUSPEND = " + (def["auto-suspend"] === undefined ? 60 : def["auto-suspend"]),
+        "AUTO_RESUME = " + (def["auto-resume"] !== false ? "TRUE" : "FALSE"),
+        "COMMENT = " + literal(def["comment"] || "")
+    ].join(" ");
+};
+
+// createWarehouse creates the warehouse, or adopts one of the same name that
+// already exists. The state records which of the two happened, so that
+// delete only drops warehouses the entity created.
+let createWarehouse = function (def) {
+    try {
+        execute(def, "CREATE WAREHOUSE " + quote(def["name"]) + " WITH INITIALLY_SUSPENDED = TRUE " + properties(def));
+        return {"name": def["name"], "created": true};
+    } catch (e) {
+        if (!common.alreadyExists(e)) {
+            throw e;
+        }
+    }
+    cli.output("Warehouse " + def["name"] + " already exists, adopting it; it won't be dropped on delete");
+    execute(def, "ALTER WAREHOUSE " + quote(def["name"]) + " SET " + properties(def));
+    return {"name": def["name"], "created": false};
+};
+
+let updateWarehouse = function (def, state) {
+    if (!state["name"]) {
+        return createWarehouse(def);
+    }
+    if (state["name"] !== def["name"]) {
+        execute(def, "ALTER WAREHOUSE " + quote(state["name"]) + " RENAME TO " + quote(def["name"]));
+        cli.output("Renamed warehouse " + state["name"] + " to " + def["name"]);
+    }
+    execute(def, "ALTER WAREHOUSE " + quote(def["name"]) + " SET " + properties(def));
+    return {"name": def["name"], "created": state["created"] === true};
+};
+
+let deleteWarehouse = function (def, state) {
+    if (state["created"] !== true) {
+        cli.output("Warehouse " + (state["name"] || def["name"]) +
+            " wasn't created by this entity, leaving it in place");
+        return;
+    }
+    execute(def, "DROP WAREHOUSE IF EXISTS " + quote(state["name"]));
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createWarehouse(def);
+        case "update":
+            return updateWarehouse(def, state);
+        case "purge":
+            deleteWarehouse(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
@@ -0,0 +1,81 @@
+// Stripe API access shared by the Stripe entities.
+let api = require("common/api");
+let managed = require("common/managed");
+let secret = require("secret");
+
+// formEncode flattens nested objects into Stripe's form encoding, e.g. metadata[key]=value
+let formEncode = function (data, prefix) {
+    let parts = [];
+    for (let key in data) {
+        let value = data[key];
+        if (value === undefined || value === null) {
+            continue;
+        }
+        let name = prefix ? prefix + "[" + key + "]" : key;
+        if (typeof value === "object") {
+            parts.push(formEncode(value, name));
+        } else {
+            parts.push(encodeURIComponent(name) + "=" + encodeURIComponent(value));
+        }
+    }
+    return parts.filter(function (p) {
+        return p !== "";
+    }).join("&");
+};
+
+// Creates get a fresh Idempotency-Key each and are resent with it after an
+// uncertain failure. Keys are never derived from the definition: Stripe
+// replays the response of a key for 24 hours, which would return an object
+// archived in the meantime.
+let stripe = api.client({
+    "name": "Stripe",
+    "baseUrl": "https://api.stripe.com/v1",
+    "headers": function (def) {
+        return {"Authorization": "Bearer " + secret.get(def["api-key-secret"])};
+    },
+    "encode": formEncode,
+    "contentType": "application/x-www-form-urlencoded",
+    "idempotencyHeader": "Idempotency-Key",
+    "validate": {
+        "path": "/balance",
+        "credentials": function (def) {
+            return "the secret key in the Monk secret " + def["api-key-secret"];
+        }
+    },
+    "message": function (body) {
+        return body.error.message;
+    },
+    "code": function (body) {
+        return body.error.code;
+    }
+});
+
+// managedMetadata returns the metadata of a definition with the marks of a
+// managed object of the entity with key
+let managedMetadata = function (def, key) {
+    return managed.applyManagedTags(def["metadata"], key);
+};
+
+// findManaged returns the managed objects of kind, e.g. "products", of the
+// entity with key, through Stripe's search. Search results lag behind
+// changes by up to a minute.
+let findManaged = function (def, kind, key) {
+    let quoted = function (value) {
+        return "'" + String(value).replace(/\\/g, "\\\\").replace(/'/g, "\\'") + "'";
+    };
+    let query = "metadata[" + quoted(managed.MANAGED) + "]:'true' AND metadata[" + quoted(managed.ENTITY) + "]:" +
+        quoted(key);
+    return stripe.listAll(def, "/" + kind + "/search?query=" + encodeURIComponent(query), {
+        "pages": "cursor",
+        "items": "data",
+        "next": "next_page",
+        "param": "page"
+    });
+};
+
+exports.formEncode = formEncode;
+exports.request = stripe.request;
+exports.remove = stripe.remove;
+exports.create = stripe.create;
+exports.managedMetadata = managedMetadata;
+exports.findManaged = findManaged;
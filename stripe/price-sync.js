@@ -0,0 +1,86 @@
+let cli = require("cli");
+let common = require("stripe/common");
+let request = common.request;
+let create = common.create;
+let managedMetadata = common.managedMetadata;
+
+// immutableFields are the price attributes Stripe doesn't allow to change
+let immutableFields = function (def) {
+    return {
+        "product": def["product"],
+        "currency": def["currency"].toLowerCase(),
+        "unit-amount": def["unit-amount"],
+        "recurring-interval": def["recurring-interval"] || "",
+        "recurring-interval-count": def["recurring-interval-count"] || 1
+    };
+};
+
+let priceData = function (def) {
+    if (!def["product"]) {
+        throw new Error("product is required, set it or connect the price to a stripe/product");
+    }
+    let data = {
+        "product": def["product"],
+        "currency": def["currency"].toLowerCase(),
+        "unit_amount": def["unit-amount"],
+        "nickname": def["nickname"],
+        "metadata": managedMetadata(def, def["product"])
+    };
+    if (def["recurring-interval"]) {
+        data["recurring"] = {
+            "interval": def["recurring-interval"],
+            "interval_count": def["recurring-interval-count"]
+        };
+    }
+    return data;
+};
+
+let updatePrice = function (def, id) {
+    return request(def, "post", "/prices/" + id, {
+        "nickname": def["nickname"] || "",
+        "metadata": managedMetadata(def, def["product"])
+    });
+};
+
+let archivePrice = function (def, id) {
+    return request(def, "post", "/prices/" + id, {"active": false});
+};
+
+let toState = function (def, price) {
+    return Object.assign({"id": price.id}, immutableFields(def));
+};
+
+function main(def, state, ctx) {
+    let price = {};
+    switch (ctx.action) {
+        case "create":
+        case "update":
+            if (ctx.action === "update" && state.id) {
+                let desired = immutableFields(def);
+                let changed = Object.keys(desired).some(function (key) {
+                    return state[key] !== desired[key];
+                });
+                if (!changed) {
+                    price = updatePrice(def, state.id);
+                    break;
+                }
+            }
+            // prices are immutable: a changed price is replaced with a new one
+            price = create(def, "/prices", priceData(def));
+            if (state.id) {
+                archivePrice(def, state.id);
+                cli.output("Replaced price " + state.id + " with " + price.id);
+            }
+            break;
+        case "purge":
+            if (state.id) {
+                archivePrice(def, state.id);
+                cli.output("Archived price " + state.id);
+            }
+            return;
+        default:
+            // no action defined
+            return;
+    }
+    return toState(def, price);
+}
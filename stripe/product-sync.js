@@ -0,0 +1,79 @@
+let cli = require("cli");
+let common = require("stripe/common");
+let request = common.request;
+let create = common.create;
+let managedMetadata = common.managedMetadata;
+let findManaged = common.findManaged;
+
+let productData = function (def) {
+    return {
+        "name": def["name"],
+        "description": def["description"],
+        "active": def["active"] !== false,
+        "metadata": managedMetadata(def, def["name"])
+    };
+};
+
+let createProduct = function (def) {
+    return create(def, "/products", productData(def));
+};
+
+let updateProduct = function (def, id) {
+    return request(def, "post", "/products/" + id, productData(def));
+};
+
+// Stripe products with prices can't be deleted, so they are archived instead
+let archiveProduct = function (def, id) {
+    return request(def, "post", "/products/" + id, {"active": false});
+};
+
+// detectOrphans reports the active products marked as made by this entity
+// other than the one in its state, e.g. left behind by a failed create. It
+// archives them only when confirm=true is passed.
+let detectOrphans = function (def, state, args) {
+    let orphans = findManaged(def, "products", def["name"]).filter(function (product) {
+        return product.active && product.id !== state.id;
+    });
+    if (orphans.length === 0) {
+        cli.output("No orphaned products of " + def["name"]);
+        return;
+    }
+    orphans.forEach(function (product) {
+        cli.output("Orphaned product " + product.id + " created " + new Date(product.created * 1000).toISOString());
+    });
+    if ((args || {})["confirm"] !== "true") {
+        cli.output("Pass confirm=true to archive them");
+        return;
+    }
+    orphans.forEach(function (product) {
+        archiveProduct(def, product.id);
+        cli.output("Archived product " + product.id);
+    });
+};
+
+function main(def, state, ctx) {
+    let product = {};
+    switch (ctx.action) {
+        case "create":
+        case "update":
+            if (ctx.action === "update" && state.id) {
+                product = updateProduct(def, state.id);
+                break;
+            }
+            product = createProduct(def);
+            break;
+        case "purge":
+            if (state.id) {
+                archiveProduct(def, state.id);
+                cli.output("Archived product " + state.id);
+            }
+            return;
+        case "detect-orphans":
+            detectOrphans(def, state, ctx.args);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+    return {"id": product.id, "name": product.name, "active": product.active};
+}
@@ -0,0 +1,150 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+
+const BASE_URL = "https://api.supabase.com/v1";
+
+let request = function (def, method, path, body) {
+    let opts = {
+        "method": method.toUpperCase(),
+        "headers": {
+            "Authorization": "Bearer " + secret.get(def["token-secret"]),
+            "Content-Type": "application/json"
+        }
+    };
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do(BASE_URL + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).message;
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+// storedPassword returns the database password from its Monk secret, or
+// null when the secret doesn't exist yet
+let storedPassword = function (def) {
+    try {
+        return secret.get(def["db-password-secret"]) || null;
+    } catch (e) {
+        return null;
+    }
+};
+
+// dbPassword returns the database password from its Monk secret, generating
+// and storing one on first use
+let dbPassword = function (def) {
+    let password = storedPassword(def);
+    if (password) {
+        return password;
+    }
+    password = secret.randString(24);
+    secret.set(def["db-password-secret"], password);
+    return password;
+};
+
+let findProject = function (def) {
+    let projects = request(def, "get", "/projects");
+    return projects.find(function (project) {
+        return project.organization_id === def["organization-id"] && project.name === def["name"];
+    });
+};
+
+let createProject = function (def) {
+    let project = findProject(def);
+    if (project) {
+        // a generated password wouldn't match the existing database
+        if (!storedPassword(def)) {
+            throw new Error("project " + def["name"] + " already exists, store its database password in the " +
+                def["db-password-secret"] + " secret to manage it");
+        }
+        cli.output("Project " + def["name"] + " already exists");
+        return project;
+    }
+    return request(def, "post", "/projects", {
+        "name": def["name"],
+        "organization_id": def["organization-id"],
+        "region": def["region"] || "us-east-1",
+        "db_pass": dbPassword(def)
+    });
+};
+
+// storeCredentials writes the API keys and the connection string to their
+// Monk secrets so they never end up in the entity state
+let storeCredentials = function (def, ref) {
+    let keys = request(def, "get", "/projects/" + ref + "/api-keys");
+    keys.forEach(function (key) {
+        if (key.name === "anon" && def["anon-key-secret"]) {
+            secret.set(def["anon-key-secret"], key.api_key);
+        }
+        if (key.name === "service_role" && def["service-key-secret"]) {
+            secret.set(def["service-key-secret"], key.api_key);
+        }
+    });
+    if (def["connection-string-secret"]) {
+        secret.set(def["connection-string-secret"], "postgresql://postgres:" +
+            encodeURIComponent(dbPassword(def)) + "@db." + ref + ".supabase.co:5432/postgres");
+    }
+};
+
+// deleteProject pauses the project before deleting it. Only some plans can
+// be paused, so a failed pause doesn't stop the delete.
+let deleteProject = function (def, state) {
+    let ref = state["ref"];
+    if (!ref) {
+        let project = findProject(def);
+        if (!project) {
+            return;
+        }
+        ref = project.id;
+    }
+    try {
+        request(def, "post", "/projects/" + ref + "/pause");
+    } catch (e) {
+        cli.output("Could not pause project " + ref + ": " + e.message);
+    }
+    try {
+        request(def, "delete", "/projects/" + ref);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            let project = createProject(def);
+            return {"ref": project.id, "region": project.region, "status": project.status, "credentials-stored": false};
+        case "check-readiness":
+            let current = request(def, "get", "/projects/" + state["ref"]);
+            if (current.status !== "ACTIVE_HEALTHY") {
+                throw new Error("project " + def["name"] + " is " + current.status);
+            }
+            if (!state["credentials-stored"]) {
+                storeCredentials(def, current.id);
+            }
+            return {
+                "ref": current.id,
+                "region": current.region,
+                "status": current.status,
+                "credentials-stored": true,
+                "host": "db." + current.id + ".supabase.co",
+                "api-url": "https://" + current.id + ".supabase.co"
+            };
+        case "purge":
+            deleteProject(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
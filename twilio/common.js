@@ -0,0 +1,38 @@
+// Twilio REST API access shared by the Twilio entities. Twilio's APIs live
+// on several hosts, so requests take full URLs.
+let api = require("common/api");
+let secret = require("secret");
+
+const MESSAGING_URL = "https://messaging.twilio.com/v1/Services";
+
+let encodeForm = function (form) {
+    return Object.keys(form).filter(function (key) {
+        return form[key] !== undefined && form[key] !== null;
+    }).map(function (key) {
+        return encodeURIComponent(key) + "=" + encodeURIComponent(form[key]);
+    }).join("&");
+};
+
+let twilio = api.client({
+    "name": "Twilio",
+    "baseUrl": "",
+    "headers": function (def) {
+        return {
+            "Authorization": "Basic " + btoa(def["account-sid"] + ":" + secret.get(def["auth-token-secret"])),
+            "Accept": "application/json"
+        };
+    },
+    "message": function (body) {
+        return body.message + " (" + body.code + ")";
+    },
+    "code": function (body) {
+        return body.code;
+    },
+    "encode": encodeForm,
+    "contentType": "application/x-www-form-urlencoded"
+});
+
+exports.MESSAGING_URL = MESSAGING_URL;
+exports.request = twilio.request;
+exports.remove = twilio.remove;
+exports.encodeForm = encodeForm;
@@ -0,0 +1,46 @@
+let cli = require("cli");
+let common = require("twilio/common");
+let request = common.request;
+let remove = common.remove;
+let MESSAGING_URL = common.MESSAGING_URL;
+
+let serviceForm = function (def) {
+    return {
+        "FriendlyName": def["name"],
+        "InboundRequestUrl": def["inbound-request-url"],
+        "StatusCallback": def["status-callback"],
+        "StickySender": def["sticky-sender"] !== false
+    };
+};
+
+let createService = function (def) {
+    let service = request(def, "post", MESSAGING_URL, serviceForm(def));
+    return {"sid": service.sid, "name": service.friendly_name};
+};
+
+let updateService = function (def, state) {
+    let service = request(def, "post", MESSAGING_URL + "/" + state["sid"], serviceForm(def));
+    return {"sid": service.sid, "name": service.friendly_name};
+};
+
+let deleteService = function (def, state) {
+    if (!state["sid"]) {
+        return;
+    }
+    remove(def, MESSAGING_URL + "/" + state["sid"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createService(def);
+        case "update":
+            return updateService(def, state);
+        case "purge":
+            deleteService(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
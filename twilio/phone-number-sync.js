@@ -0,0 +1,130 @@
+let cli = require("cli");
+let common = require("twilio/common");
+let request = common.request;
+let remove = common.remove;
+let encodeForm = common.encodeForm;
+let MESSAGING_URL = common.MESSAGING_URL;
+let isNotFound = require("common/api").isNotFound;
+
+let accountUrl = function (def) {
+    return "https://api.twilio.com/2010-04-01/Accounts/" + def["account-sid"];
+};
+
+// findOwned returns the number on the account carrying the friendly name, so
+// that a repeated create doesn't purchase a second one
+let findOwned = function (def) {
+    let owned = request(def, "get", accountUrl(def) + "/IncomingPhoneNumbers.json?FriendlyName=" +
+        encodeURIComponent(def["friendly-name"])).incoming_phone_numbers || [];
+    return owned.length > 0 ? owned[0] : null;
+};
+
+let purchase = function (def) {
+    let query = encodeForm({
+        "AreaCode": def["area-code"],
+        "SmsEnabled": def["sms-enabled"] ? true : null,
+        "VoiceEnabled": def["voice-enabled"] ? true : null,
+        "PageSize": 1
+    });
+    let available = request(def, "get", accountUrl(def) + "/AvailablePhoneNumbers/" + (def["country"] || "US") +
+        "/Local.json?" + query).available_phone_numbers || [];
+    if (available.length === 0) {
+        throw new Error("no phone numbers available in " + (def["country"] || "US") +
+            (def["area-code"] ? " with area code " + def["area-code"] : ""));
+    }
+
+    cli.output("Purchasing " + available[0].phone_number + " (" + available[0].locality + ", " + available[0].region + ")");
+    let number = request(def, "post", accountUrl(def) + "/IncomingPhoneNumbers.json", {
+        "PhoneNumber": available[0].phone_number,
+        "FriendlyName": def["friendly-name"]
+    });
+    cli.output("Purchased " + number.phone_number + " as " + number.sid);
+    return number;
+};
+
+// attach adds the number to the messaging service unless it is there already
+let attach = function (def, number) {
+    if (!def["messaging-service"]) {
+        return;
+    }
+    let url = MESSAGING_URL + "/" + def["messaging-service"] + "/PhoneNumbers";
+    try {
+        request(def, "get", url + "/" + number.sid);
+        return;
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+    request(def, "post", url, {"PhoneNumberSid": number.sid});
+    cli.output("Added " + number.phone_number + " to messaging service " + def["messaging-service"]);
+};
+
+let detach = function (def, state) {
+    if (!state["messaging-service"]) {
+        return;
+    }
+    remove(def, MESSAGING_URL + "/" + state["messaging-service"] + "/PhoneNumbers/" + state["sid"]);
+};
+
+let numberState = function (def, number) {
+    return {"sid": number.sid, "phone-number": number.phone_number, "messaging-service": def["messaging-service"] || ""};
+};
+
+let createNumber = function (def) {
+    let number = findOwned(def);
+    if (number) {
+        cli.output("Using " + number.phone_number + " (" + number.sid + ") already owned as " + def["friendly-name"] +
+            ", nothing purchased");
+    } else {
+        number = purchase(def);
+    }
+    attach(def, number);
+    return numberState(def, number);
+};
+
+let updateNumber = function (def, state) {
+    let number = request(def, "get", accountUrl(def) + "/IncomingPhoneNumbers/" + state["sid"] + ".json");
+    if (number.friendly_name !== def["friendly-name"]) {
+        number = request(def, "post", accountUrl(def) + "/IncomingPhoneNumbers/" + state["sid"] + ".json",
+            {"FriendlyName": def["friendly-name"]});
+    }
+    if (state["messaging-service"] !== (def["messaging-service"] || "")) {
+        detach(def, state);
+    }
+    attach(def, number);
+    return numberState(def, number);
+};
+
+let deleteNumber = function (def, state) {
+    if (!state["sid"]) {
+        return;
+    }
+    detach(def, state);
+    if (!def["release-on-delete"]) {
+        cli.output("Keeping " + state["phone-number"] + " on the account, set release-on-delete to release it");
+        return;
+    }
+    try {
+        request(def, "delete", accountUrl(def) + "/IncomingPhoneNumbers/" + state["sid"] + ".json");
+        cli.output("Released " + state["phone-number"]);
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createNumber(def);
+        case "update":
+            return updateNumber(def, state);
+        case "purge":
+            deleteNumber(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
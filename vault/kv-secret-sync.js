@@ -0,0 +1,128 @@
+let cli = require("cli");
+let http = require("http");
+let secret = require("secret");
+
+let baseHeaders = function (def) {
+    let headers = {"Content-Type": "application/json"};
+    if (def["namespace"]) {
+        headers["X-Vault-Namespace"] = def["namespace"];
+    }
+    return headers;
+};
+
+let call = function (def, method, path, headers, body) {
+    let opts = {"method": method.toUpperCase(), "headers": headers};
+    if (body) {
+        opts["body"] = JSON.stringify(body);
+    }
+    let res = http.do(def["address"].replace(/\/+$/, "") + "/v1/" + path, opts);
+    if (res.error) {
+        let message = res.body;
+        try {
+            message = JSON.parse(res.body).errors.join("; ");
+        } catch (e) {
+            // keep the raw body
+        }
+        throw new Error(res.error + ", " + message);
+    }
+    return res.body ? JSON.parse(res.body) : {};
+};
+
+// login returns a Vault token, either the configured one or a fresh token
+// from an AppRole login
+let login = function (def) {
+    if (def["token-secret"]) {
+        return secret.get(def["token-secret"]);
+    }
+    if (def["role-id"] && def["secret-id-secret"]) {
+        let res = call(def, "post", "auth/" + (def["approle-mount"] || "approle") + "/login", baseHeaders(def), {
+            "role_id": def["role-id"],
+            "secret_id": secret.get(def["secret-id-secret"])
+        });
+        return res.auth.client_token;
+    }
+    throw new Error("either token-secret or role-id and secret-id-secret must be set");
+};
+
+let request = function (def, token, method, path, body) {
+    let headers = baseHeaders(def);
+    headers["X-Vault-Token"] = token;
+    return call(def, method, path, headers, body);
+};
+
+let mount = function (def) {
+    return def["mount"] || "secret";
+};
+
+let desiredData = function (def) {
+    let data = Object.assign({}, def["data"]);
+    let fromSecrets = def["secret-data"] || {};
+    for (let key in fromSecrets) {
+        data[key] = secret.get(fromSecrets[key]);
+    }
+    return data;
+};
+
+let sameData = function (a, b) {
+    let keys = Object.keys(a);
+    if (keys.length !== Object.keys(b).length) {
+        return false;
+    }
+    return keys.every(function (key) {
+        return b[key] === a[key];
+    });
+};
+
+// readCurrent returns the latest version of the secret, or null if it doesn't
+// exist or the latest version was deleted
+let readCurrent = function (def, token) {
+    try {
+        return request(def, token, "get", mount(def) + "/data/" + def["path"]).data;
+    } catch (e) {
+        if (e.message.includes("response code 404")) {
+            return null;
+        }
+        throw e;
+    }
+};
+
+// writeSecret writes a new version only when the data differs from the
+// latest one, so repeated updates don't pile up identical versions
+let writeSecret = function (def) {
+    let token = login(def);
+    let data = desiredData(def);
+    let current = readCurrent(def, token);
+    if (current && current.data && sameData(current.data, data)) {
+        cli.output("Secret " + def["path"] + " is up to date at version " + current.metadata.version);
+        return current.metadata.version;
+    }
+    let res = request(def, token, "post", mount(def) + "/data/" + def["path"], {"data": data});
+    return res.data.version;
+};
+
+let deleteSecret = function (def) {
+    let token = login(def);
+    let path = def["destroy-on-delete"] ? "/metadata/" : "/data/";
+    try {
+        request(def, token, "delete", mount(def) + path + def["path"]);
+    } catch (e) {
+        if (!e.message.includes("response code 404")) {
+            throw e;
+        }
+    }
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+        case "update":
+            // only the version is kept in state, never the secret values
+            return {"mount": mount(def), "path": def["path"], "version": writeSecret(def)};
+        case "purge":
+            deleteSecret(def);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
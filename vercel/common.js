@@ -0,0 +1,33 @@
+// Vercel REST API access shared by the Vercel entities.
+let api = require("common/api");
+let secret = require("secret");
+
+let vercel = api.client({
+    "name": "Vercel",
+    "baseUrl": "https://api.vercel.com",
+    // requests for a team's resources carry its ID as a query parameter
+    "url": function (def, url) {
+        if (!def["team-id"]) {
+            return url;
+        }
+        return url + (url.includes("?") ? "&" : "?") + "teamId=" + encodeURIComponent(def["team-id"]);
+    },
+    "headers": function (def) {
+        return {"Authorization": "Bearer " + secret.get(def["token-secret"])};
+    },
+    "validate": {
+        "path": "/v2/user",
+        "credentials": function (def) {
+            return "the token in the Monk secret " + def["token-secret"];
+        }
+    },
+    "message": function (body) {
+        return body.error.message;
+    },
+    "code": function (body) {
+        return body.error.code;
+    }
+});
+
+exports.request = vercel.request;
+exports.remove = vercel.remove;
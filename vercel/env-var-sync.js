@@ -0,0 +1,89 @@
+let cli = require("cli");
+let secret = require("secret");
+let crypto = require("common/crypto");
+let common = require("vercel/common");
+let request = common.request;
+let remove = common.remove;
+
+// valueHash keys the hash of the value with the access token, see common/crypto
+let valueHash = function (def, value) {
+    return crypto.valueHash(secret.get(def["token-secret"]), value);
+};
+
+let targets = function (def) {
+    return (def["targets"] || ["production", "preview", "development"]).slice().sort();
+};
+
+// envPath returns the project's env endpoint. Creating variables is on
+// v10 of the API, editing and deleting them on v9.
+let envPath = function (project, version) {
+    if (!project) {
+        throw new Error("project is required, set it or connect the variable to a vercel/project");
+    }
+    return "/" + version + "/projects/" + encodeURIComponent(project) + "/env";
+};
+
+let toState = function (def, id, hash) {
+    return {"id": id, "project": def["project"], "key": def["key"], "targets": targets(def), "value-hash": hash};
+};
+
+let createEnvVar = function (def) {
+    let value = secret.get(def["value-secret"]);
+    let res = request(def, "post", envPath(def["project"], "v10"), {
+        "key": def["key"],
+        "value": value,
+        "type": "encrypted",
+        "target": targets(def)
+    });
+    let created = Array.isArray(res.created) ? res.created[0] : res.created;
+    cli.output("Set " + def["key"] + " for " + targets(def).join(", "));
+    return toState(def, created.id, valueHash(def, value));
+};
+
+// updateEnvVar only sends the variable when its key, value hash or targets
+// changed. A variable moved to another project is created on the new one
+// and then deleted from the old one, as its id only exists in the old project.
+let updateEnvVar = function (def, state) {
+    if (state["project"] && state["project"] !== def["project"]) {
+        let created = createEnvVar(def);
+        deleteEnvVar(def, state);
+        return created;
+    }
+    let value = secret.get(def["value-secret"]);
+    let hash = valueHash(def, value);
+    if (def["key"] === state["key"] && hash === state["value-hash"] &&
+        JSON.stringify(targets(def)) === JSON.stringify(state["targets"])) {
+        // state from before the project was recorded is taken to be on the current one
+        return Object.assign({}, state, {"project": def["project"]});
+    }
+    request(def, "patch", envPath(def["project"], "v9") + "/" + state["id"], {
+        "key": def["key"],
+        "value": value,
+        "type": "encrypted",
+        "target": targets(def)
+    });
+    cli.output("Updated " + def["key"] + " for " + targets(def).join(", "));
+    return toState(def, state["id"], hash);
+};
+
+let deleteEnvVar = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    remove(def, envPath(state["project"] || def["project"], "v9") + "/" + state["id"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createEnvVar(def);
+        case "update":
+            return updateEnvVar(def, state);
+        case "purge":
+            deleteEnvVar(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}
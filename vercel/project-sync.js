@@ -0,0 +1,63 @@
+let cli = require("cli");
+let common = require("vercel/common");
+let request = common.request;
+let remove = common.remove;
+let isNotFound = require("common/api").isNotFound;
+
+let settings = function (def) {
+    let data = {
+        "framework": def["framework"] || null,
+        "rootDirectory": def["root-directory"] || null,
+        "installCommand": def["install-command"] || null,
+        "buildCommand": def["build-command"] || null,
+        "outputDirectory": def["output-directory"] || null
+    };
+    return data;
+};
+
+let createProject = function (def) {
+    try {
+        let project = request(def, "get", "/v9/projects/" + encodeURIComponent(def["name"]));
+        cli.output("Project " + def["name"] + " already exists");
+        return updateProject(def, {"id": project.id});
+    } catch (e) {
+        if (!isNotFound(e)) {
+            throw e;
+        }
+    }
+    let data = Object.assign({"name": def["name"]}, settings(def));
+    if (def["git-repository"]) {
+        data["gitRepository"] = {"type": def["git-provider"] || "github", "repo": def["git-repository"]};
+    }
+    let project = request(def, "post", "/v11/projects", data);
+    return {"id": project.id, "name": project.name};
+};
+
+// updateProject applies the build settings. The git repository is only
+// linked on create, relinking goes through the project's git settings.
+let updateProject = function (def, state) {
+    let project = request(def, "patch", "/v9/projects/" + state["id"], Object.assign({"name": def["name"]}, settings(def)));
+    return {"id": project.id, "name": project.name};
+};
+
+let deleteProject = function (def, state) {
+    if (!state["id"]) {
+        return;
+    }
+    remove(def, "/v9/projects/" + state["id"]);
+};
+
+function main(def, state, ctx) {
+    switch (ctx.action) {
+        case "create":
+            return createProject(def);
+        case "update":
+            return updateProject(def, state);
+        case "purge":
+            deleteProject(def, state);
+            return;
+        default:
+            // no action defined
+            return;
+    }
+}